@@ -0,0 +1,225 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Dialer 包含连接到 WebSocket 服务器的选项。
+type Dialer struct {
+	// NetDialContext 指定用于创建 TCP 连接的拨号函数。
+	// 如果 NetDialContext 为 nil，则使用 net.Dialer。
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// TLSClientConfig 指定用于 tls.Client 的 TLS 配置。
+	// 如果为 nil，则使用默认配置。
+	TLSClientConfig *tls.Config
+
+	// HandshakeTimeout 指定完成握手的时间限制。零表示没有超时。
+	HandshakeTimeout time.Duration
+
+	// ReadBufferSize 指定读缓冲区的字节大小。如果为零，则使用默认大小。
+	ReadBufferSize int
+}
+
+// DefaultDialer 是所有字段都设置为默认值的拨号器。
+var DefaultDialer = &Dialer{
+	HandshakeTimeout: 45 * time.Second,
+}
+
+// DialContext 使用给定的上下文创建新的客户端连接。
+//
+// 请求头可以指定 Origin 和其他头部。
+//
+// 如果 WebSocket 握手失败，将返回 ErrBadHandshake 以及服务器的响应，
+// 以便调用者可以处理重定向、身份验证等。
+func (d *Dialer) DialContext(ctx context.Context, urlStr string, requestHeader http.Header) (*Conn, *http.Response, error) {
+	if d == nil {
+		d = DefaultDialer
+	}
+	challengeKey, err := generateChallengeKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, nil, errors.New("websocket: bad scheme " + u.Scheme)
+	}
+	if u.User != nil {
+		// 不在请求行中发送用户信息。
+		return nil, nil, errors.New("websocket: user information in URL not supported")
+	}
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range requestHeader {
+		switch {
+		case k == "Host":
+			if len(vs) > 0 {
+				req.Host = vs[0]
+			}
+		case k == "Upgrade" || k == "Connection" || k == "Sec-Websocket-Key" ||
+			k == "Sec-Websocket-Version" || k == "Sec-Websocket-Extensions":
+			return nil, nil, errors.New("websocket: duplicate header not allowed: " + k)
+		default:
+			req.Header[k] = vs
+		}
+	}
+	req.Header["Upgrade"] = []string{"websocket"}
+	req.Header["Connection"] = []string{"Upgrade"}
+	req.Header["Sec-WebSocket-Key"] = []string{challengeKey}
+	req.Header["Sec-WebSocket-Version"] = []string{"13"}
+
+	if d.HandshakeTimeout != 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, d.HandshakeTimeout)
+		defer cancel()
+	}
+
+	netDial := d.NetDialContext
+	if netDial == nil {
+		netDial = new(net.Dialer).DialContext
+	}
+	hostPort, hostNoPort := hostPortNoPort(u)
+	netConn, err := netDial(ctx, "tcp", hostPort)
+	if err != nil {
+		return nil, nil, contextError(ctx, err)
+	}
+	defer func() {
+		if netConn != nil {
+			netConn.Close()
+		}
+	}()
+
+	// 在上下文被取消时中止握手。stopWatch 确保监视 goroutine 在返回前退出，
+	// 这样它就不会修改已经建立的连接的截止时间。
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	var (
+		stop    = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	go func(conn net.Conn) {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}(netConn)
+	stopWatch := func() {
+		if stop != nil {
+			close(stop)
+			<-stopped
+			stop = nil
+		}
+	}
+	defer stopWatch()
+
+	if u.Scheme == "https" {
+		cfg := d.TLSClientConfig
+		if cfg == nil {
+			cfg = new(tls.Config)
+		} else {
+			cfg = cfg.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = hostNoPort
+		}
+		tlsConn := tls.Client(netConn, cfg)
+		netConn = tlsConn
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, nil, contextError(ctx, err)
+		}
+	}
+
+	if err := req.Write(netConn); err != nil {
+		return nil, nil, contextError(ctx, err)
+	}
+
+	size := d.ReadBufferSize
+	if size == 0 {
+		size = defaultReadBufferSize
+	}
+	br := bufio.NewReaderSize(netConn, size)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, nil, contextError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!tokenListContainsValue(resp.Header, "Upgrade", "websocket") ||
+		!tokenListContainsValue(resp.Header, "Connection", "upgrade") ||
+		resp.Header.Get("Sec-Websocket-Accept") != computeAcceptKey(challengeKey) {
+		// 在响应中保留部分响应体，以便调用者诊断。
+		buf := make([]byte, 1024)
+		n, _ := io.ReadFull(resp.Body, buf)
+		resp.Body = io.NopCloser(strings.NewReader(string(buf[:n])))
+		return nil, resp, ErrBadHandshake
+	}
+	resp.Body = io.NopCloser(strings.NewReader(""))
+
+	stopWatch()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	conn := newConn(netConn, br, false)
+	netConn = nil // 避免在 defer 中关闭。
+	return conn, resp, nil
+}
+
+// contextError 在握手因为 ctx 被取消或到期而失败时返回 ctx 的错误，否则返回 err。
+// 连接的截止时间可能在 ctx 的计时器之前触发，所以对于 ctx 的截止时间
+// 已过之后发生的超时错误，需要等待 ctx 结束。
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var netErr net.Error
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) && errors.As(err, &netErr) && netErr.Timeout() {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+func hostPortNoPort(u *url.URL) (hostPort, hostNoPort string) {
+	hostPort = u.Host
+	hostNoPort = u.Host
+	if i := strings.LastIndex(u.Host, ":"); i > strings.LastIndex(u.Host, "]") {
+		hostNoPort = hostNoPort[:i]
+	} else {
+		switch u.Scheme {
+		case "https":
+			hostPort += ":443"
+		default:
+			hostPort += ":80"
+		}
+	}
+	return hostPort, hostNoPort
+}
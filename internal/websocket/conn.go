@@ -0,0 +1,492 @@
+// Package websocket 实现了 RFC 6455 WebSocket 协议的一个最小子集，
+// 足以承载 JSON-RPC 消息。API 仿照 github.com/gorilla/websocket。
+//
+// 不支持扩展（例如 permessage-deflate）和子协议协商。
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 消息类型，数值与 RFC 6455 中的操作码相同。
+const (
+	// TextMessage 表示 UTF-8 编码的文本数据消息。
+	TextMessage = 1
+
+	// BinaryMessage 表示二进制数据消息。
+	BinaryMessage = 2
+
+	// CloseMessage 表示关闭控制消息。可选的消息负载包含数字代码和文本。
+	// 使用 FormatCloseMessage 函数来格式化关闭消息负载。
+	CloseMessage = 8
+
+	// PingMessage 表示 ping 控制消息。可选的消息负载是 UTF-8 编码的文本。
+	PingMessage = 9
+
+	// PongMessage 表示 pong 控制消息。可选的消息负载是 UTF-8 编码的文本。
+	PongMessage = 10
+)
+
+// 关闭代码，定义于 RFC 6455 第 11.7 节。
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseNoStatusReceived = 1005
+	CloseAbnormalClosure  = 1006
+	CloseMessageTooBig    = 1009
+)
+
+const (
+	continuationFrame = 0
+
+	finalBit = 1 << 7
+	rsvBits  = 7 << 4
+	maskBit  = 1 << 7
+
+	maxControlFramePayloadSize = 125
+	maxFrameHeaderSize         = 2 + 8 + 4
+
+	defaultReadBufferSize = 4096
+
+	// defaultReadLimit 是没有调用 SetReadLimit 时消息的最大字节数。
+	defaultReadLimit = 32 * 1024 * 1024
+
+	// maxInt 是 int 能表示的最大值。消息的长度不能超过它。
+	maxInt = int64(^uint(0) >> 1)
+)
+
+var (
+	// ErrReadLimit 在读取的消息大于 SetReadLimit 设置的限制时返回。
+	ErrReadLimit = errors.New("websocket: read limit exceeded")
+
+	// ErrBadHandshake 在服务器响应不符合握手要求时由 Dialer 返回。
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+
+	// ErrCloseSent 在已经发送关闭消息之后继续写入时返回。
+	ErrCloseSent = errors.New("websocket: close sent")
+
+	errInvalidControlFrame = errors.New("websocket: invalid control frame")
+)
+
+var keyGUID = []byte("258EAFA5-E914-47DA-95CA-C5AB0DC85B11")
+
+// CloseError 表示对端发送的关闭消息。
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	s := "websocket: close " + strconv.Itoa(e.Code)
+	if e.Text != "" {
+		s += ": " + e.Text
+	}
+	return s
+}
+
+// IsCloseError 在 err 是给定代码之一的 *CloseError 时返回 true。
+func IsCloseError(err error, codes ...int) bool {
+	var e *CloseError
+	if errors.As(err, &e) {
+		for _, code := range codes {
+			if e.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FormatCloseMessage 将关闭代码和文本格式化为 WebSocket 关闭消息。
+// 如果代码是 CloseNoStatusReceived，则返回空消息。
+func FormatCloseMessage(closeCode int, text string) []byte {
+	if closeCode == CloseNoStatusReceived {
+		return []byte{}
+	}
+	buf := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(buf, uint16(closeCode))
+	copy(buf[2:], text)
+	return buf
+}
+
+// Conn 表示一个 WebSocket 连接。
+//
+// 连接支持一个并发读取者和多个并发写入者。
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool
+
+	// 读取端的状态，只能由读取者访问。
+	readLimit   int64
+	readErr     error
+	handlePing  func(string) error
+	handlePong  func(string) error
+	handleClose func(int, string) error
+
+	// 写入端的状态。
+	wmu       sync.Mutex
+	closeSent bool
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	if br == nil {
+		br = bufio.NewReaderSize(conn, defaultReadBufferSize)
+	}
+	c := &Conn{conn: conn, br: br, isServer: isServer, readLimit: defaultReadLimit}
+	c.SetPingHandler(nil)
+	c.SetPongHandler(nil)
+	c.SetCloseHandler(nil)
+	return c
+}
+
+// Close 关闭底层网络连接，不发送或等待关闭消息。
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// LocalAddr 返回本地网络地址。
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr 返回远程网络地址。
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline 设置底层网络连接的读取截止时间。
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline 设置底层网络连接的写入截止时间。
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadLimit 设置从对端读取的消息的最大字节数。如果消息超过限制，
+// 连接会向对端发送关闭消息，并向应用程序返回 ErrReadLimit。
+// 零或负数的限制恢复默认值 32 MiB。
+func (c *Conn) SetReadLimit(limit int64) {
+	switch {
+	case limit <= 0:
+		limit = defaultReadLimit
+	case limit > maxInt:
+		limit = maxInt
+	}
+	c.readLimit = limit
+}
+
+// SetPingHandler 设置从对端收到 ping 消息时的处理程序。
+// 默认的处理程序会向对端回复 pong 消息。
+func (c *Conn) SetPingHandler(h func(appData string) error) {
+	if h == nil {
+		h = func(message string) error {
+			err := c.WriteControl(PongMessage, []byte(message), time.Now().Add(time.Second))
+			if err == ErrCloseSent {
+				return nil
+			} else if e, ok := err.(net.Error); ok && e.Timeout() {
+				return nil
+			}
+			return err
+		}
+	}
+	c.handlePing = h
+}
+
+// SetPongHandler 设置从对端收到 pong 消息时的处理程序。
+// 默认的处理程序什么也不做。
+func (c *Conn) SetPongHandler(h func(appData string) error) {
+	if h == nil {
+		h = func(string) error { return nil }
+	}
+	c.handlePong = h
+}
+
+// SetCloseHandler 设置从对端收到关闭消息时的处理程序。
+// 默认的处理程序会向对端回复关闭消息。
+func (c *Conn) SetCloseHandler(h func(code int, text string) error) {
+	if h == nil {
+		h = func(code int, text string) error {
+			message := FormatCloseMessage(code, "")
+			c.WriteControl(CloseMessage, message, time.Now().Add(time.Second))
+			return nil
+		}
+	}
+	c.handleClose = h
+}
+
+// WriteControl 使用给定的截止时间写入控制消息。
+// 允许的消息类型是 CloseMessage、PingMessage 和 PongMessage。
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if !isControl(messageType) {
+		return errors.New("websocket: bad control message type")
+	}
+	if len(data) > maxControlFramePayloadSize {
+		return errInvalidControlFrame
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.conn.SetWriteDeadline(deadline)
+	return c.writeFrame(messageType, data)
+}
+
+// WriteMessage 将数据作为单个帧写入。
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if isControl(messageType) {
+		if len(data) > maxControlFramePayloadSize {
+			return errInvalidControlFrame
+		}
+	} else if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: bad message type %d", messageType)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	return c.writeFrame(messageType, data)
+}
+
+// WriteJSON 将 v 的 JSON 编码作为文本消息写入。
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, data)
+}
+
+// writeFrame 写入单个 FIN 帧。调用者必须持有 c.wmu。
+func (c *Conn) writeFrame(messageType int, data []byte) error {
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	frame := make([]byte, 0, maxFrameHeaderSize+len(data))
+	frame = append(frame, finalBit|byte(messageType))
+
+	var b1 byte
+	if !c.isServer {
+		b1 = maskBit
+	}
+	switch n := len(data); {
+	case n <= 125:
+		frame = append(frame, b1|byte(n))
+	case n <= 0xffff:
+		var ext [2]byte
+		binary.BigEndian.PutUint16(ext[:], uint16(n))
+		frame = append(frame, b1|126)
+		frame = append(frame, ext[:]...)
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, b1|127)
+		frame = append(frame, ext[:]...)
+	}
+
+	if c.isServer {
+		frame = append(frame, data...)
+	} else {
+		// 客户端发送的所有帧都必须被掩码。
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		frame = append(frame, key[:]...)
+		start := len(frame)
+		frame = append(frame, data...)
+		maskBytes(key, frame[start:])
+	}
+
+	if messageType == CloseMessage {
+		c.closeSent = true
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// ReadMessage 读取下一条数据消息。控制消息在读取过程中由相应的处理程序处理。
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	messageType, p, err = c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+	return messageType, p, err
+}
+
+// ReadJSON 读取下一条消息，并将其 JSON 编码解码到 v 中。
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err == io.EOF {
+		// 空消息不是有效的 JSON。
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (c *Conn) readMessage() (int, []byte, error) {
+	var (
+		messageType int
+		message     []byte
+	)
+	for {
+		final, opcode, payload, err := c.readFrame(int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err := c.handlePing(string(payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if err := c.handlePong(string(payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.readClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.protocolError("message start before final message frame")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.protocolError("continuation after final message frame")
+			}
+		default:
+			return 0, nil, c.protocolError("unknown opcode " + strconv.Itoa(opcode))
+		}
+		message = append(message, payload...)
+		if final {
+			return messageType, message, nil
+		}
+	}
+}
+
+// readFrame 读取单个帧。read 是当前消息已经读取的字节数，用于执行读取限制。
+func (c *Conn) readFrame(read int64) (final bool, opcode int, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	final = hdr[0]&finalBit != 0
+	opcode = int(hdr[0] & 0xf)
+	if hdr[0]&rsvBits != 0 {
+		return false, 0, nil, c.protocolError("unexpected reserved bits")
+	}
+	masked := hdr[1]&maskBit != 0
+	length := int64(hdr[1] &^ maskBit)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return false, 0, nil, c.protocolError("invalid payload length")
+		}
+	}
+
+	if isControl(opcode) && (!final || length > maxControlFramePayloadSize) {
+		return false, 0, nil, c.protocolError("invalid control frame")
+	}
+	if masked != c.isServer {
+		return false, 0, nil, c.protocolError("bad MASK")
+	}
+	// 在分配负载之前检查限制。read 不会超过 readLimit，所以减法不会溢出。
+	if !isControl(opcode) && length > c.readLimit-read {
+		c.WriteControl(CloseMessage, FormatCloseMessage(CloseMessageTooBig, ""), time.Now().Add(time.Second))
+		return false, 0, nil, ErrReadLimit
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+	return final, opcode, payload, nil
+}
+
+func (c *Conn) readClose(payload []byte) error {
+	closeCode := CloseNoStatusReceived
+	closeText := ""
+	if len(payload) >= 2 {
+		closeCode = int(binary.BigEndian.Uint16(payload))
+		closeText = string(payload[2:])
+	} else if len(payload) == 1 {
+		return c.protocolError("invalid close payload")
+	}
+	if err := c.handleClose(closeCode, closeText); err != nil {
+		return err
+	}
+	return &CloseError{Code: closeCode, Text: closeText}
+}
+
+func (c *Conn) protocolError(message string) error {
+	c.WriteControl(CloseMessage, FormatCloseMessage(CloseProtocolError, message), time.Now().Add(time.Second))
+	return errors.New("websocket: " + message)
+}
+
+func isControl(opcode int) bool {
+	return opcode == CloseMessage || opcode == PingMessage || opcode == PongMessage
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+func computeAcceptKey(challengeKey string) string {
+	h := sha1.New()
+	h.Write([]byte(challengeKey))
+	h.Write(keyGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func generateChallengeKey() (string, error) {
+	p := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, p); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(p), nil
+}
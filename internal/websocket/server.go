@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HandshakeError 描述服务器握手期间的错误。
+type HandshakeError struct {
+	message string
+}
+
+func (e HandshakeError) Error() string { return e.message }
+
+// Upgrader 指定将 HTTP 连接升级为 WebSocket 连接的参数。
+type Upgrader struct {
+	// ReadBufferSize 指定读缓冲区的字节大小。如果为零，则使用默认大小。
+	ReadBufferSize int
+
+	// CheckOrigin 在请求的 Origin 头可接受时返回 true。如果 CheckOrigin 为 nil，
+	// 则使用安全的默认值：如果存在 Origin 请求头并且源主机不等于
+	// 请求的 Host 头，则返回 false。
+	CheckOrigin func(r *http.Request) bool
+}
+
+func (u *Upgrader) returnError(w http.ResponseWriter, status int, reason string) (*Conn, error) {
+	err := HandshakeError{reason}
+	w.Header().Set("Sec-Websocket-Version", "13")
+	http.Error(w, http.StatusText(status), status)
+	return nil, err
+}
+
+// checkSameOrigin 在 origin 未设置或等于请求主机时返回 true。
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header["Origin"]
+	if len(origin) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin[0])
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade 将 HTTP 服务器连接升级为 WebSocket 协议。
+//
+// responseHeader 包含在对客户端升级请求的响应中。
+//
+// 如果升级失败，Upgrade 会向客户端回复 HTTP 错误响应。
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*Conn, error) {
+	const badHandshake = "websocket: the client is not using the websocket protocol: "
+
+	if !tokenListContainsValue(r.Header, "Connection", "upgrade") {
+		return u.returnError(w, http.StatusBadRequest, badHandshake+"'upgrade' token not found in 'Connection' header")
+	}
+	if !tokenListContainsValue(r.Header, "Upgrade", "websocket") {
+		return u.returnError(w, http.StatusBadRequest, badHandshake+"'websocket' token not found in 'Upgrade' header")
+	}
+	if r.Method != http.MethodGet {
+		return u.returnError(w, http.StatusMethodNotAllowed, badHandshake+"request method is not GET")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		return u.returnError(w, http.StatusBadRequest, "websocket: unsupported version: 13 not found in 'Sec-Websocket-Version' header")
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = checkSameOrigin
+	}
+	if !checkOrigin(r) {
+		return u.returnError(w, http.StatusForbidden, "websocket: request origin not allowed by Upgrader.CheckOrigin")
+	}
+
+	challengeKey := r.Header.Get("Sec-Websocket-Key")
+	if challengeKey == "" {
+		return u.returnError(w, http.StatusBadRequest, "websocket: not a websocket handshake: 'Sec-WebSocket-Key' header is missing or blank")
+	}
+
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return u.returnError(w, http.StatusInternalServerError, "websocket: response does not implement http.Hijacker")
+	}
+	netConn, brw, err := h.Hijack()
+	if err != nil {
+		return u.returnError(w, http.StatusInternalServerError, err.Error())
+	}
+	if brw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, errors.New("websocket: client sent data before handshake is complete")
+	}
+
+	var br *bufio.Reader
+	if u.ReadBufferSize == 0 {
+		// 复用 HTTP 服务器的读缓冲区。
+		br = brw.Reader
+	} else {
+		br = bufio.NewReaderSize(netConn, u.ReadBufferSize)
+	}
+
+	var p []byte
+	p = append(p, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: "...)
+	p = append(p, computeAcceptKey(challengeKey)...)
+	p = append(p, "\r\n"...)
+	for k, vs := range responseHeader {
+		if k == "Sec-Websocket-Protocol" || k == "Sec-Websocket-Extensions" {
+			continue
+		}
+		for _, v := range vs {
+			p = append(p, k...)
+			p = append(p, ": "...)
+			for i := 0; i < len(v); i++ {
+				b := v[i]
+				if b <= 31 {
+					// 防止响应拆分。
+					b = ' '
+				}
+				p = append(p, b)
+			}
+			p = append(p, "\r\n"...)
+		}
+	}
+	p = append(p, "\r\n"...)
+
+	if _, err := netConn.Write(p); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return newConn(netConn, br, true), nil
+}
+
+// tokenListContainsValue 在头部 name 中的逗号分隔列表包含 value 时返回 true。
+func tokenListContainsValue(header http.Header, name string, value string) bool {
+	for _, s := range header[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(s, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
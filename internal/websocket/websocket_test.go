@@ -0,0 +1,296 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEchoServer(t *testing.T, upgrader Upgrader, setup func(*Conn)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if setup != nil {
+			setup(conn)
+		}
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(typ, msg); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestEcho(t *testing.T) {
+	srv := newEchoServer(t, Upgrader{}, nil)
+	defer srv.Close()
+
+	conn, resp, err := DefaultDialer.DialContext(context.Background(), wsURL(srv), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("wrong status %d", resp.StatusCode)
+	}
+
+	// 覆盖所有三种长度编码。
+	for _, size := range []int{0, 10, 125, 126, 1000, 0xffff, 0x10000, 1 << 20} {
+		msg := bytes.Repeat([]byte{'x'}, size)
+		if err := conn.WriteMessage(TextMessage, msg); err != nil {
+			t.Fatalf("size %d: write error: %v", size, err)
+		}
+		typ, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("size %d: read error: %v", size, err)
+		}
+		if typ != TextMessage || !bytes.Equal(got, msg) {
+			t.Fatalf("size %d: wrong echo (type %d, len %d)", size, typ, len(got))
+		}
+	}
+
+	var v struct{ A string }
+	if err := conn.WriteJSON(map[string]string{"A": "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != "b" {
+		t.Fatalf("wrong JSON echo %+v", v)
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	srv := newEchoServer(t, Upgrader{}, nil)
+	defer srv.Close()
+
+	conn, _, err := DefaultDialer.DialContext(context.Background(), wsURL(srv), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pong := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		pong <- data
+		return nil
+	})
+	if err := conn.WriteControl(PingMessage, []byte("hello"), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// 控制消息在 ReadMessage 期间处理，因此需要在读取时触发。
+	if err := conn.WriteMessage(TextMessage, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-pong:
+		if data != "hello" {
+			t.Fatalf("wrong pong payload %q", data)
+		}
+	default:
+		t.Fatal("no pong received")
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	srv := newEchoServer(t, Upgrader{}, func(c *Conn) { c.SetReadLimit(100) })
+	defer srv.Close()
+
+	conn, _, err := DefaultDialer.DialContext(context.Background(), wsURL(srv), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(TextMessage, make([]byte, 101)); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = conn.ReadMessage()
+	if !IsCloseError(err, CloseMessageTooBig) {
+		t.Fatalf("expected close error %d, got %v", CloseMessageTooBig, err)
+	}
+}
+
+// frameConn 是一个从固定数据读取并记录所有写入的 net.Conn，用于直接测试帧解析。
+type frameConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *frameConn) Write(b []byte) (int, error)      { return c.written.Write(b) }
+func (c *frameConn) SetWriteDeadline(time.Time) error { return nil }
+
+// newFrameReader 创建一个从 data 读取帧的客户端连接。
+func newFrameReader(data []byte) (*Conn, *frameConn) {
+	fc := new(frameConn)
+	return newConn(fc, bufio.NewReader(bytes.NewReader(data)), false), fc
+}
+
+// frameHeader 返回一个未掩码的帧头，负载长度使用 64 位编码。
+func frameHeader(opcode byte, final bool, length uint64) []byte {
+	hdr := []byte{opcode, 127, 0, 0, 0, 0, 0, 0, 0, 0}
+	if final {
+		hdr[0] |= finalBit
+	}
+	binary.BigEndian.PutUint64(hdr[2:], length)
+	return hdr
+}
+
+// 此测试检查超过限制的帧长度在分配负载之前被拒绝。
+func TestReadFrameLength(t *testing.T) {
+	for _, length := range []uint64{1<<63 - 1, defaultReadLimit + 1} {
+		conn, fc := newFrameReader(frameHeader(TextMessage, true, length))
+		if _, _, err := conn.ReadMessage(); err != ErrReadLimit {
+			t.Fatalf("length %d: wrong error %v, want %v", length, err, ErrReadLimit)
+		}
+		// 客户端发送的关闭帧是掩码的：2 字节帧头、4 字节掩码键和 2 字节关闭代码。
+		w := fc.written.Bytes()
+		if len(w) != 8 || w[0] != finalBit|CloseMessage {
+			t.Fatalf("length %d: no close message sent, wrote %x", length, w)
+		}
+		var key [4]byte
+		copy(key[:], w[2:6])
+		maskBytes(key, w[6:])
+		if code := binary.BigEndian.Uint16(w[6:]); code != CloseMessageTooBig {
+			t.Fatalf("length %d: wrong close code %d", length, code)
+		}
+	}
+}
+
+// 此测试检查读取限制作用于分片消息的总长度。
+func TestReadLimitContinuation(t *testing.T) {
+	var data []byte
+	data = append(data, frameHeader(TextMessage, false, 100)...)
+	data = append(data, make([]byte, 100)...)
+	data = append(data, frameHeader(continuationFrame, true, 100)...)
+	data = append(data, make([]byte, 100)...)
+
+	conn, _ := newFrameReader(data)
+	conn.SetReadLimit(150)
+	if _, _, err := conn.ReadMessage(); err != ErrReadLimit {
+		t.Fatalf("wrong error %v, want %v", err, ErrReadLimit)
+	}
+
+	conn, _ = newFrameReader(data)
+	conn.SetReadLimit(200)
+	if _, msg, err := conn.ReadMessage(); err != nil || len(msg) != 200 {
+		t.Fatalf("unexpected result: %d bytes, err %v", len(msg), err)
+	}
+}
+
+func FuzzReadMessage(f *testing.F) {
+	f.Add([]byte{0x81, 0x05, 'h', 'e', 'l', 'l', 'o'})
+	f.Add([]byte{0x01, 0x01, 'a', 0x89, 0x00, 0x80, 0x01, 'b'})
+	f.Add([]byte{0x88, 0x02, 0x03, 0xe8})
+	f.Add(frameHeader(TextMessage, true, 1<<63-1))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		conn, _ := newFrameReader(data)
+		conn.SetReadLimit(1024)
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if len(msg) > 1024 {
+				t.Fatalf("message of %d bytes exceeds read limit", len(msg))
+			}
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	srv := newEchoServer(t, Upgrader{}, nil)
+	defer srv.Close()
+
+	conn, _, err := DefaultDialer.DialContext(context.Background(), wsURL(srv), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := FormatCloseMessage(CloseNormalClosure, "bye")
+	if err := conn.WriteControl(CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// 服务器回复关闭消息。
+	_, _, err = conn.ReadMessage()
+	if !IsCloseError(err, CloseNormalClosure) {
+		t.Fatalf("expected normal closure, got %v", err)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("x")); err != ErrCloseSent {
+		t.Fatalf("expected ErrCloseSent, got %v", err)
+	}
+}
+
+func TestOriginCheck(t *testing.T) {
+	srv := newEchoServer(t, Upgrader{}, nil)
+	defer srv.Close()
+
+	header := http.Header{"Origin": {"http://evil.example.com"}}
+	_, resp, err := DefaultDialer.DialContext(context.Background(), wsURL(srv), header)
+	if !errors.Is(err, ErrBadHandshake) {
+		t.Fatalf("expected ErrBadHandshake, got %v", err)
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 response, got %v", resp)
+	}
+
+	header = http.Header{"Origin": {srv.URL}}
+	conn, _, err := DefaultDialer.DialContext(context.Background(), wsURL(srv), header)
+	if err != nil {
+		t.Fatalf("same-origin dial failed: %v", err)
+	}
+	conn.Close()
+}
+
+func TestUpgradeNonWebsocket(t *testing.T) {
+	srv := newEchoServer(t, Upgrader{}, nil)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 response, got %d", resp.StatusCode)
+	}
+}
+
+func TestDialContextCanceled(t *testing.T) {
+	// 这个服务器接受 TCP 连接，但从不完成握手。
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err := DefaultDialer.DialContext(ctx, wsURL(srv), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
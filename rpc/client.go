@@ -4,6 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"flychain/log"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,15 +17,22 @@ var (
 	ErrBadResult                 = errors.New("bad result in JSON-RPC response")
 	ErrClientQuit                = errors.New("client is closed")
 	ErrNoResult                  = errors.New("no result in JSON-RPC response")
+	ErrMissingBatchResponse      = errors.New("response batch did not contain a response to this call")
 	ErrSubscriptionQueueOverflow = errors.New("subscription queue overflow")
 	errClientReconnected         = errors.New("client reconnected")
 	errDead                      = errors.New("connection lost")
+	errServerSideRegister        = errors.New("can't register services on a server-side connection")
 )
 
 const (
 	//Timeouts
 	defaultDialTimeout = 10 * time.Second // used if context has no deadline
 	subscribeTimeout   = 5 * time.Second  // overall timeout eth_subscribe, rpc_modules calls
+
+	// 重连失败后的等待时间从 minReconnectBackoff 开始倍增，
+	// 直到达到上限（默认为 defaultMaxReconnectBackoff）。
+	minReconnectBackoff        = 100 * time.Millisecond
+	defaultMaxReconnectBackoff = 5 * time.Second
 )
 
 const (
@@ -51,9 +64,14 @@ type BatchElem struct {
 
 // Client 表示与 RPC 服务器的连接。
 type Client struct {
-	idgen    func() ID // for subscriptions
-	isHTTP   bool      // connection type: http, ws or ipc
-	services *serviceRegistry
+	// maxReconnectBackoff 是重连退避时间的上限（time.Duration）。
+	// 它通过原子操作访问，放在首位以保证 64 位对齐。
+	maxReconnectBackoff int64
+
+	idgen      func() ID // for subscriptions
+	isHTTP     bool      // connection type: http, ws or ipc
+	services   *serviceRegistry
+	handlerCfg *handlerConfig // 服务器端连接的处理程序设置，客户端为 nil
 
 	idCounter uint32
 
@@ -97,8 +115,559 @@ type readOp struct {
 }
 
 type requestOp struct {
-	ids []json.RawMessage
-	err error
+	ids  []json.RawMessage
+	err  error
 	resp chan *jsonrpcMessage // 最多接收 len(ids) 个响应
-	sub *ClientSub
+	sub  *ClientSubscription  // 仅为 Subscribe 请求设置
+}
+
+func (op *requestOp) wait(ctx context.Context, c *Client) (*jsonrpcMessage, error) {
+	select {
+	case <-ctx.Done():
+		// 将超时发送给调度，以便它可以删除请求 ID。
+		if !c.isHTTP {
+			select {
+			case c.reqTimeout <- op:
+			case <-c.closing:
+			}
+		}
+		return nil, ctx.Err()
+	case resp, ok := <-op.resp:
+		if !ok {
+			// op.resp 只有在出错时才会被关闭。
+			return nil, op.err
+		}
+		return resp, nil
+	}
+}
+
+// Dial 为给定的 URL 创建一个新的客户端。
+//
+// 当前支持的 URL 方案有 "http"、"https"、"ws" 和 "wss"。如果 rawurl 是
+// 没有 URL 方案的文件名，则使用 Unix 域套接字建立本地套接字连接。
+func Dial(rawurl string) (*Client, error) {
+	return DialContext(context.Background(), rawurl)
+}
+
+// DialContext 创建一个新的 RPC 客户端，就像 Dial 一样。
+//
+// 上下文用于取消或超时初始连接的建立。它不影响与客户端的后续交互。
+func DialContext(ctx context.Context, rawurl string) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultDialTimeout)
+		defer cancel()
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return DialHTTP(rawurl)
+	case "ws", "wss":
+		return DialWebsocket(ctx, rawurl, "")
+	case "":
+		return DialIPC(ctx, rawurl)
+	default:
+		return nil, fmt.Errorf("no known transport for URL scheme %q", u.Scheme)
+	}
+}
+
+func newClient(initctx context.Context, connect reconnectFunc) (*Client, error) {
+	conn, err := connect(initctx)
+	if err != nil {
+		return nil, err
+	}
+	c := initClient(conn, randomIDGenerator(), new(serviceRegistry), nil)
+	c.reconnectFunc = connect
+	return c, nil
+}
+
+func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry, cfg *handlerConfig) *Client {
+	_, isHTTP := conn.(*httpConn)
+	c := &Client{
+		isHTTP:      isHTTP,
+		idgen:       idgen,
+		services:    services,
+		handlerCfg:  cfg,
+		writeConn:   conn,
+		close:       make(chan struct{}),
+		closing:     make(chan struct{}),
+		didClose:    make(chan struct{}),
+		reconnected: make(chan ServerCodec),
+		readOp:      make(chan readOp),
+		readErr:     make(chan error),
+		reqInit:     make(chan *requestOp),
+		reqSent:     make(chan error, 1),
+		reqTimeout:  make(chan *requestOp),
+
+		maxReconnectBackoff: int64(defaultMaxReconnectBackoff),
+	}
+	if !isHTTP {
+		go c.dispatch(conn)
+	}
+	return c
+}
+
+func (c *Client) nextID() json.RawMessage {
+	id := atomic.AddUint32(&c.idCounter, 1)
+	return strconv.AppendUint(nil, uint64(id), 10)
+}
+
+// Close 关闭客户端，中止任何进行中的请求。
+func (c *Client) Close() {
+	if c.isHTTP {
+		return
+	}
+	select {
+	case c.close <- struct{}{}:
+		<-c.didClose
+	case <-c.didClose:
+	}
+}
+
+// RegisterName 在给定名称下注册服务，连接另一端的服务器可以通过同一个
+// 连接调用它的方法。方法的规则与 Server.RegisterName 相同。
+//
+// 回调只能通过 WebSocket、IPC 和进程内连接进行，HTTP 连接上的服务器
+// 无法调用客户端。服务器端的连接没有自己的服务，因此返回错误。
+func (c *Client) RegisterName(name string, receiver interface{}) error {
+	if c.handlerCfg != nil {
+		return errServerSideRegister
+	}
+	return c.services.registerName(name, receiver)
+}
+
+// ClientFromContext 返回正在处理的调用所在连接的客户端。服务器端的方法
+// 可以用它调用客户端通过 Client.RegisterName 注册的服务。
+// 对于 HTTP 请求，没有这样的客户端，ok 为 false。
+func ClientFromContext(ctx context.Context) (*Client, bool) {
+	client, ok := ctx.Value(clientContextKey{}).(*Client)
+	return client, ok
+}
+
+// SetMaxReconnectBackoff 设置两次重连尝试之间等待时间的上限。
+// 此设置仅对能够重连的传输（WebSocket 和 IPC）有效。
+func (c *Client) SetMaxReconnectBackoff(max time.Duration) {
+	if max < minReconnectBackoff {
+		max = minReconnectBackoff
+	}
+	atomic.StoreInt64(&c.maxReconnectBackoff, int64(max))
+}
+
+// Call 使用给定的参数执行 JSON-RPC 调用，并在没有发生错误时
+// 将结果解组到 result 中。
+//
+// result 必须是指针，以便包 json 可以将结果解组到其中。
+// 也可以传入 nil，在这种情况下结果被忽略。
+func (c *Client) Call(result interface{}, method string, args ...interface{}) error {
+	ctx := context.Background()
+	return c.CallContext(ctx, result, method, args...)
+}
+
+// CallContext 使用给定的参数执行 JSON-RPC 调用。如果上下文在
+// 调用成功返回之前被取消，CallContext 会立即返回。
+//
+// result 必须是指针，以便包 json 可以将结果解组到其中。
+// 也可以传入 nil，在这种情况下结果被忽略。
+func (c *Client) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if result != nil && reflect.TypeOf(result).Kind() != reflect.Ptr {
+		return fmt.Errorf("call result parameter must be pointer or nil interface: %v", result)
+	}
+	msg, err := c.newMessage(method, args...)
+	if err != nil {
+		return err
+	}
+	op := &requestOp{ids: []json.RawMessage{msg.ID}, resp: make(chan *jsonrpcMessage, 1)}
+
+	if c.isHTTP {
+		err = c.sendHTTP(ctx, op, msg)
+	} else {
+		err = c.send(ctx, op, msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 调度已接受请求，并会在退出时关闭通道。
+	switch resp, err := op.wait(ctx, c); {
+	case err != nil:
+		return err
+	case resp.Error != nil:
+		return resp.Error
+	case len(resp.Result) == 0:
+		return ErrNoResult
+	default:
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, &result)
+	}
+}
+
+// BatchCall 将所有给定的请求作为单个批次发送，并等待服务器
+// 返回所有请求的响应。
+//
+// 与 Call 相比，批量调用只返回 I/O 错误。任何特定于某个请求的错误
+// 都通过相应 BatchElem 的 Error 字段报告。如果服务器因为批处理限制
+// 没有回复某个请求，该请求的 Error 为 ErrMissingBatchResponse。
+//
+// 请注意，批量调用可能不会在服务器端原子地执行。
+func (c *Client) BatchCall(b []BatchElem) error {
+	ctx := context.Background()
+	return c.BatchCallContext(ctx, b)
+}
+
+// BatchCallContext 将所有给定的请求作为单个批次发送，并等待服务器
+// 返回所有请求的响应。
+//
+// 与 CallContext 相比，批量调用只返回 I/O 错误。任何特定于某个请求的错误
+// 都通过相应 BatchElem 的 Error 字段报告。
+//
+// 请注意，批量调用可能不会在服务器端原子地执行。
+func (c *Client) BatchCallContext(ctx context.Context, b []BatchElem) error {
+	var (
+		msgs = make([]*jsonrpcMessage, len(b))
+		byID = make(map[string]int, len(b))
+	)
+	op := &requestOp{
+		ids:  make([]json.RawMessage, len(b)),
+		resp: make(chan *jsonrpcMessage, len(b)),
+	}
+	for i, elem := range b {
+		msg, err := c.newMessage(elem.Method, elem.Args...)
+		if err != nil {
+			return err
+		}
+		msgs[i] = msg
+		op.ids[i] = msg.ID
+		byID[string(msg.ID)] = i
+	}
+
+	var err error
+	if c.isHTTP {
+		err = c.sendBatchHTTP(ctx, op, msgs)
+	} else {
+		err = c.send(ctx, op, msgs)
+	}
+
+	// 等待所有响应返回。
+	for n := 0; n < len(b) && err == nil; n++ {
+		var resp *jsonrpcMessage
+		resp, err = op.wait(ctx, c)
+		if err != nil {
+			break
+		}
+		// 找到此响应对应的元素。HTTP 响应没有经过调度的检查，
+		// 所以 ID 可能是未知的。
+		index, ok := byID[string(resp.ID)]
+		if !ok {
+			continue
+		}
+		delete(byID, string(resp.ID))
+		elem := &b[index]
+		if resp.Error != nil {
+			elem.Error = resp.Error
+			continue
+		}
+		if len(resp.Result) == 0 {
+			elem.Error = ErrNoResult
+			continue
+		}
+		elem.Error = json.Unmarshal(resp.Result, elem.Result)
+	}
+	// 服务器没有回复所有请求，为剩余的元素报告错误。
+	if err == ErrMissingBatchResponse {
+		for _, index := range byID {
+			b[index].Error = ErrMissingBatchResponse
+		}
+		err = nil
+	}
+	return err
+}
+
+// Notify 发送一个通知，即不期望响应的方法调用。
+func (c *Client) Notify(ctx context.Context, method string, args ...interface{}) error {
+	op := new(requestOp)
+	msg, err := c.newMessage(method, args...)
+	if err != nil {
+		return err
+	}
+	msg.ID = nil
+
+	if c.isHTTP {
+		// 服务器不会为通知返回任何内容，所以不需要解码响应体。
+		respBody, err := c.writeConn.(*httpConn).doRequest(ctx, msg)
+		if err != nil {
+			return err
+		}
+		return respBody.Close()
+	}
+	return c.send(ctx, op, msg)
+}
+
+// EthSubscribe 使用 "eth" 命名空间注册订阅。
+func (c *Client) EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*ClientSubscription, error) {
+	return c.Subscribe(ctx, "eth", channel, args...)
+}
+
+// Subscribe 使用给定的参数调用 "<namespace>_subscribe" 方法，
+// 注册一个订阅。订阅的服务器通知被发送到给定的通道。
+// 通道的元素类型必须与订阅返回的内容的预期类型相匹配。
+//
+// 上下文参数用于取消设置订阅的 RPC 请求，
+// 但对订阅建立之后没有影响。
+//
+// 缓慢的订阅者最终会被丢弃。只要订阅存在，客户端缓冲区最多
+// 可以保存 20000 条通知。如果达到此限制，订阅将被取消，
+// 并在订阅的 Err 通道上报告 ErrSubscriptionQueueOverflow。
+func (c *Client) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (*ClientSubscription, error) {
+	// 首先检查通道的类型。
+	chanVal := reflect.ValueOf(channel)
+	if chanVal.Kind() != reflect.Chan || chanVal.Type().ChanDir()&reflect.SendDir == 0 {
+		panic(fmt.Sprintf("channel argument of Subscribe has type %T, need writable channel", channel))
+	}
+	if chanVal.IsNil() {
+		panic("channel given to Subscribe must not be nil")
+	}
+	if c.isHTTP {
+		return nil, ErrNotificationsUnsupported
+	}
+
+	msg, err := c.newMessage(namespace+subscribeMethodSuffix, args...)
+	if err != nil {
+		return nil, err
+	}
+	op := &requestOp{
+		ids:  []json.RawMessage{msg.ID},
+		resp: make(chan *jsonrpcMessage),
+		sub:  newClientSubscription(c, namespace, chanVal),
+	}
+
+	// 发送订阅请求。
+	// 响应的到达和有效性通过 op.resp 的关闭和 op.err 通知。
+	if err := c.send(ctx, op, msg); err != nil {
+		return nil, err
+	}
+	if _, err := op.wait(ctx, c); err != nil {
+		return nil, err
+	}
+	return op.sub, nil
+}
+
+// SetHeader 为客户端的请求添加自定义 HTTP 头。
+// 此方法仅适用于使用 HTTP 的客户端，对于使用其他传输方式的客户端没有任何作用。
+func (c *Client) SetHeader(key, value string) {
+	if !c.isHTTP {
+		return
+	}
+	conn := c.writeConn.(*httpConn)
+	conn.mu.Lock()
+	conn.headers.Set(key, value)
+	conn.mu.Unlock()
+}
+
+func (c *Client) newMessage(method string, paramsIn ...interface{}) (*jsonrpcMessage, error) {
+	msg := &jsonrpcMessage{Version: vsn, ID: c.nextID(), Method: method}
+	if paramsIn != nil { // 防止发送 "params":null
+		var err error
+		if msg.Params, err = json.Marshal(paramsIn); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// send 向调度循环注册 op，然后在连接上发送 msg。
+// 如果发送失败，op 会被注销。
+func (c *Client) send(ctx context.Context, op *requestOp, msg interface{}) error {
+	select {
+	case c.reqInit <- op:
+		err := c.write(ctx, msg, false)
+		c.reqSent <- err
+		return err
+	case <-ctx.Done():
+		// 如果客户端过载或跟不上订阅通知，就会发生这种情况。
+		return ctx.Err()
+	case <-c.closing:
+		return ErrClientQuit
+	}
+}
+
+func (c *Client) write(ctx context.Context, msg interface{}, retry bool) error {
+	if c.writeConn == nil {
+		// 之前的写入失败了。尝试建立新的连接。
+		if err := c.reconnect(ctx); err != nil {
+			return err
+		}
+	}
+	err := c.writeConn.writeJSON(ctx, msg, false)
+	if err != nil {
+		c.writeConn = nil
+		if !retry {
+			return c.write(ctx, msg, true)
+		}
+	}
+	return err
+}
+
+// reconnect 使用 reconnectFunc 重新建立连接。失败的尝试之间按指数退避等待，
+// 直到连接成功、ctx 结束或客户端关闭。
+func (c *Client) reconnect(ctx context.Context) error {
+	if c.reconnectFunc == nil {
+		return errDead
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, defaultDialTimeout)
+		defer cancel()
+	}
+
+	var (
+		backoff    = minReconnectBackoff
+		maxBackoff = time.Duration(atomic.LoadInt64(&c.maxReconnectBackoff))
+	)
+	for {
+		newconn, err := c.reconnectFunc(ctx)
+		if err == nil {
+			select {
+			case c.reconnected <- newconn:
+				c.writeConn = newconn
+				return nil
+			case <-c.didClose:
+				newconn.close()
+				return ErrClientQuit
+			}
+		}
+		log.Trace("RPC client reconnect failed", "err", err, "backoff", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-c.didClose:
+			timer.Stop()
+			return ErrClientQuit
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// dispatch 是客户端的主循环。
+// 它将读取的消息发送给等待中的 Call 调用，
+// 并将订阅通知发送给已注册的订阅。
+func (c *Client) dispatch(codec ServerCodec) {
+	var (
+		lastOp      *requestOp  // 跟踪最后一次发送操作
+		reqInitLock = c.reqInit // 持有发送锁时为 nil
+		conn        = c.newClientConn(codec)
+		reading     = true
+	)
+	defer func() {
+		close(c.closing)
+		if reading {
+			conn.close(ErrClientQuit, nil)
+			c.drainRead()
+		}
+		close(c.didClose)
+	}()
+
+	// 启动初始读取循环。
+	go c.read(codec)
+
+	for {
+		select {
+		case <-c.close:
+			return
+
+		// 读取路径：
+		case op := <-c.readOp:
+			if op.batch {
+				conn.handler.handleBatch(op.msgs)
+			} else {
+				conn.handler.handleMsg(op.msgs[0])
+			}
+
+		case err := <-c.readErr:
+			conn.handler.log.Debug("RPC connection read error", "err", err)
+			conn.close(fmt.Errorf("%w: %v", errDead, err), lastOp)
+			reading = false
+
+		// 重连：
+		case newcodec := <-c.reconnected:
+			log.Debug("RPC client reconnected", "reading", reading, "conn", newcodec.remoteAddr())
+			if reading {
+				// 等待之前的读取循环退出。这种情况很少见，发生在连接断开后
+				// 本循环没有及时得到通知时，此时调用者会先发现并重连。
+				// 关闭处理程序会终止所有等待中的请求（关闭 op.resp），
+				// lastOp 除外，它会被转移到新的处理程序。
+				conn.close(errClientReconnected, lastOp)
+				c.drainRead()
+			}
+			go c.read(newcodec)
+			reading = true
+			conn = c.newClientConn(newcodec)
+			// 在新的处理程序上重新注册进行中的请求，因为它将在那里被发送。
+			conn.handler.addRequestOp(lastOp)
+
+		// 发送路径：
+		case op := <-reqInitLock:
+			// 在当前请求发送完成之前停止监听后续请求。
+			reqInitLock = nil
+			lastOp = op
+			conn.handler.addRequestOp(op)
+
+		case err := <-c.reqSent:
+			if err != nil {
+				// 删除最后一次发送的响应处理程序。当读取循环
+				// 退出时，它会通知所有其他当前操作。
+				conn.handler.removeRequestOp(lastOp)
+			}
+			// 让下一个请求进入。
+			reqInitLock = c.reqInit
+			lastOp = nil
+
+		case op := <-c.reqTimeout:
+			conn.handler.removeRequestOp(op)
+		}
+	}
+}
+
+// drainRead 丢弃读取的消息，直到发生错误。
+func (c *Client) drainRead() {
+	for {
+		select {
+		case <-c.readOp:
+		case <-c.readErr:
+			return
+		}
+	}
+}
+
+// read 从编解码器解码 RPC 消息，并将它们送入调度循环。
+func (c *Client) read(codec ServerCodec) {
+	for {
+		msgs, batch, err := codec.readBatch()
+		if _, ok := err.(*json.SyntaxError); ok {
+			codec.writeJSON(context.Background(), errorMessage(&parseError{err.Error()}), true)
+		}
+		if err != nil {
+			c.readErr <- err
+			return
+		}
+		c.readOp <- readOp{msgs, batch}
+	}
+}
+
+func (c *Client) newClientConn(conn ServerCodec) *clientConn {
+	ctx := context.WithValue(context.Background(), clientContextKey{}, c)
+	handler := NewHandler(ctx, conn, c.idgen, c.services)
+	handler.configure(c.handlerCfg)
+	handler.peer = conn.peerInfo()
+	return &clientConn{conn, handler}
 }
@@ -0,0 +1,230 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"flychain/event"
+	"net"
+	"testing"
+	"time"
+)
+
+// ClientSubscription 必须能够当作 event.Subscription 使用。
+var _ event.Subscription = (*ClientSubscription)(nil)
+
+// fakeSubServer 是一个最小的 JSON-RPC 服务器，它接受 "nftest_subscribe" 调用，
+// 然后发送第一个参数指定数量的通知。
+type fakeSubServer struct {
+	conn    net.Conn
+	unsubCh chan string
+}
+
+func newFakeSubClient(t *testing.T) (*Client, *fakeSubServer) {
+	p1, p2 := net.Pipe()
+	srv := &fakeSubServer{conn: p1, unsubCh: make(chan string, 1)}
+	go srv.serve()
+	client, err := newClient(context.Background(), func(context.Context) (ServerCodec, error) {
+		return NewCodec(p2), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		p1.Close()
+	})
+	return client, srv
+}
+
+func (s *fakeSubServer) serve() {
+	dec := json.NewDecoder(s.conn)
+	enc := json.NewEncoder(s.conn)
+	for {
+		var msg jsonrpcMessage
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+		switch msg.Method {
+		case "nftest_subscribe":
+			var params []int
+			json.Unmarshal(msg.Params, &params)
+			enc.Encode(&jsonrpcMessage{Version: vsn, ID: msg.ID, Result: json.RawMessage(`"0x1"`)})
+			for i := 0; i < params[0]; i++ {
+				result, _ := json.Marshal(i)
+				sr, _ := json.Marshal(&subscriptionResult{ID: "0x1", Result: result})
+				notification := &jsonrpcMessage{Version: vsn, Method: "nftest" + notificationMethodSuffix, Params: sr}
+				if err := enc.Encode(notification); err != nil {
+					return
+				}
+			}
+		case "nftest_unsubscribe":
+			var params []string
+			json.Unmarshal(msg.Params, &params)
+			enc.Encode(&jsonrpcMessage{Version: vsn, ID: msg.ID, Result: json.RawMessage(`true`)})
+			s.unsubCh <- params[0]
+		}
+	}
+}
+
+func TestClientSubscribeInvalidArg(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	check := func(shouldPanic bool, arg interface{}) {
+		defer func() {
+			err := recover()
+			if shouldPanic && err == nil {
+				t.Errorf("EthSubscribe should've panicked for %#v", arg)
+			}
+			if !shouldPanic && err != nil {
+				t.Errorf("EthSubscribe shouldn't have panicked for %#v", arg)
+			}
+		}()
+		client.EthSubscribe(context.Background(), arg, "foo_bar")
+	}
+	check(true, nil)
+	check(true, 1)
+	check(true, (chan int)(nil))
+	check(true, make(<-chan int))
+	check(false, make(chan int))
+	check(false, make(chan<- int))
+}
+
+func TestClientSubscribe(t *testing.T) {
+	client, srv := newFakeSubClient(t)
+
+	const count = 10
+	ch := make(chan int)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sub, err := client.Subscribe(ctx, "nftest", ch, count)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	for i := 0; i < count; i++ {
+		select {
+		case v := <-ch:
+			if v != i {
+				t.Fatalf("wrong value %d, want %d", v, i)
+			}
+		case err := <-sub.Err():
+			t.Fatal("subscription error:", err)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for notification", i)
+		}
+	}
+
+	// Unsubscribe 应该在服务器上取消订阅并关闭错误通道。
+	sub.Unsubscribe()
+	select {
+	case id := <-srv.unsubCh:
+		if id != "0x1" {
+			t.Fatalf("wrong subscription ID %q unsubscribed", id)
+		}
+	case <-ctx.Done():
+		t.Fatal("server did not receive unsubscribe")
+	}
+	if _, ok := <-sub.Err(); ok {
+		t.Fatal("error channel not closed after unsubscribe")
+	}
+}
+
+// 此测试检查不读取通知的订阅者在缓冲区溢出时被丢弃。
+func TestClientSubscriptionOverflow(t *testing.T) {
+	client, srv := newFakeSubClient(t)
+
+	ch := make(chan int)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sub, err := client.Subscribe(ctx, "nftest", ch, maxClientSubscriptionBuffer+1)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	select {
+	case err := <-sub.Err():
+		if err != ErrSubscriptionQueueOverflow {
+			t.Fatalf("wrong error %v, want %v", err, ErrSubscriptionQueueOverflow)
+		}
+	case <-ctx.Done():
+		t.Fatal("subscription not dropped on overflow")
+	}
+	// 被丢弃的订阅也应该在服务器上取消。
+	select {
+	case <-srv.unsubCh:
+	case <-ctx.Done():
+		t.Fatal("server did not receive unsubscribe")
+	}
+	sub.Unsubscribe()
+}
+
+// 此测试检查客户端关闭时，订阅的错误通道收到 nil。
+func TestClientSubscriptionClientClose(t *testing.T) {
+	client, _ := newFakeSubClient(t)
+
+	ch := make(chan int, 1)
+	sub, err := client.Subscribe(context.Background(), "nftest", ch, 0)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	client.Close()
+	select {
+	case err := <-sub.Err():
+		if err != nil {
+			t.Fatalf("wrong error %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not ended on client close")
+	}
+}
+
+// 此测试检查在连接关闭后，即使没有读取 Err，Unsubscribe 也不会阻塞。
+func TestClientSubscriptionUnsubscribeAfterClose(t *testing.T) {
+	t.Run("ClientClose", func(t *testing.T) {
+		client, _ := newFakeSubClient(t)
+		sub, err := client.Subscribe(context.Background(), "nftest", make(chan int), 0)
+		if err != nil {
+			t.Fatal("can't subscribe:", err)
+		}
+		client.Close()
+		checkUnsubscribeReturns(t, sub)
+	})
+	t.Run("ServerError", func(t *testing.T) {
+		client, srv := newFakeSubClient(t)
+		sub, err := client.Subscribe(context.Background(), "nftest", make(chan int), 0)
+		if err != nil {
+			t.Fatal("can't subscribe:", err)
+		}
+		srv.conn.Close()
+		// 等待客户端注意到连接已经断开。
+		if err := client.Call(nil, "nftest_echo", 1); err == nil {
+			t.Fatal("expected error for call on closed connection")
+		}
+		checkUnsubscribeReturns(t, sub)
+	})
+}
+
+func checkUnsubscribeReturns(t *testing.T, sub *ClientSubscription) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		sub.Unsubscribe()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unsubscribe blocked")
+	}
+}
+
+func TestClientSubscribeHTTP(t *testing.T) {
+	client, err := DialHTTP("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Subscribe(context.Background(), "nftest", make(chan int), 0); err != ErrNotificationsUnsupported {
+		t.Fatalf("wrong error %v, want %v", err, ErrNotificationsUnsupported)
+	}
+}
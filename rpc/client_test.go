@@ -0,0 +1,494 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientRequest(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp echoResult
+	if err := client.Call(&resp, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp, echoResult{"hello", 10, &echoArgs{"world"}}) {
+		t.Errorf("incorrect result %#v", resp)
+	}
+}
+
+func TestClientResponseType(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	if err := client.Call(nil, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Errorf("Passing nil as result should be fine, but got an error: %v", err)
+	}
+	var resultVar echoResult
+	// 注意：传入的是值而不是指针。
+	err := client.Call(resultVar, "test_echo", "hello", 10, &echoArgs{"world"})
+	if err == nil {
+		t.Error("Passing a var as result should be an error")
+	}
+}
+
+// 此测试检查服务器返回的错误码和错误数据是否被传递给调用者。
+func TestClientErrorData(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp interface{}
+	err := client.Call(&resp, "test_returnError")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// 检查错误码。
+	if e, ok := err.(Error); !ok {
+		t.Fatalf("client did not return rpc.Error, got %#v", e)
+	} else if e.ErrorCode() != (testError{}.ErrorCode()) {
+		t.Fatalf("wrong error code %d, want %d", e.ErrorCode(), testError{}.ErrorCode())
+	}
+	// 检查错误数据。
+	if e, ok := err.(DataError); !ok {
+		t.Fatalf("client did not return rpc.DataError, got %#v", e)
+	} else if e.ErrorData() != (testError{}.ErrorData()) {
+		t.Fatalf("wrong error data %#v, want %#v", e.ErrorData(), testError{}.ErrorData())
+	}
+}
+
+func TestClientBatchRequest(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	batch := []BatchElem{
+		{
+			Method: "test_echo",
+			Args:   []interface{}{"hello", 10, &echoArgs{"world"}},
+			Result: new(echoResult),
+		},
+		{
+			Method: "test_echo",
+			Args:   []interface{}{"hello2", 11, &echoArgs{"world"}},
+			Result: new(echoResult),
+		},
+		{
+			Method: "no_such_method",
+			Args:   []interface{}{1, 2, 3},
+			Result: new(int),
+		},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	wantResult := []BatchElem{
+		{
+			Method: "test_echo",
+			Args:   []interface{}{"hello", 10, &echoArgs{"world"}},
+			Result: &echoResult{"hello", 10, &echoArgs{"world"}},
+		},
+		{
+			Method: "test_echo",
+			Args:   []interface{}{"hello2", 11, &echoArgs{"world"}},
+			Result: &echoResult{"hello2", 11, &echoArgs{"world"}},
+		},
+		{
+			Method: "no_such_method",
+			Args:   []interface{}{1, 2, 3},
+			Result: new(int),
+			Error:  &jsonError{Code: -32601, Message: "the method no_such_method does not exist/is not available"},
+		},
+	}
+	if !reflect.DeepEqual(batch, wantResult) {
+		t.Errorf("batch results mismatch:\ngot %+v\nwant %+v", batch, wantResult)
+	}
+}
+
+// 此测试检查客户端如何报告服务器的批处理限制。
+func TestClientBatchLimits(t *testing.T) {
+	server := newTestServer()
+	server.SetBatchLimits(4, 50)
+	defer server.Stop()
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	dialers := map[string]func() *Client{
+		"inproc": func() *Client { return DialInProc(server) },
+		"http": func() *Client {
+			c, _ := DialHTTP(httpsrv.URL)
+			return c
+		},
+	}
+	for name, dial := range dialers {
+		t.Run(name+"/items", func(t *testing.T) {
+			client := dial()
+			defer client.Close()
+
+			batch := make([]BatchElem, 5)
+			for i := range batch {
+				batch[i] = BatchElem{Method: "test_repeat", Args: []interface{}{"x", 1}, Result: new(string)}
+			}
+			if err := client.BatchCall(batch); err != nil {
+				t.Fatal(err)
+			}
+			var rpcErr Error
+			if !errors.As(batch[0].Error, &rpcErr) || rpcErr.ErrorCode() != -32600 || rpcErr.Error() != errMsgBatchTooLarge {
+				t.Errorf("wrong error for first element: %v", batch[0].Error)
+			}
+			for i, elem := range batch[1:] {
+				if elem.Error != ErrMissingBatchResponse {
+					t.Errorf("wrong error for element %d: %v", i+1, elem.Error)
+				}
+			}
+		})
+		t.Run(name+"/size", func(t *testing.T) {
+			client := dial()
+			defer client.Close()
+
+			// 每个结果有 32 个字节，第二个响应超出了限制。
+			batch := make([]BatchElem, 4)
+			for i := range batch {
+				batch[i] = BatchElem{Method: "test_repeat", Args: []interface{}{"0123456789", 3}, Result: new(string)}
+			}
+			if err := client.BatchCall(batch); err != nil {
+				t.Fatal(err)
+			}
+			for i, elem := range batch[:2] {
+				if elem.Error != nil || len(*elem.Result.(*string)) != 30 {
+					t.Errorf("element %d: unexpected result %q, err %v", i, *elem.Result.(*string), elem.Error)
+				}
+			}
+			for i, elem := range batch[2:] {
+				var rpcErr Error
+				if !errors.As(elem.Error, &rpcErr) || rpcErr.ErrorCode() != errcodeResponseTooLarge {
+					t.Errorf("wrong error for element %d: %v", i+2, elem.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestClientNotify(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	if err := client.Notify(context.Background(), "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signerService 在客户端注册，由服务器回调。
+type signerService struct{}
+
+func (s *signerService) Sign(data string) string {
+	return "signed:" + data
+}
+
+// callbackService 在服务器上注册，它通过 ClientFromContext 调用客户端。
+type callbackService struct{}
+
+func (s *callbackService) Sign(ctx context.Context, data string) (string, error) {
+	c, ok := ClientFromContext(ctx)
+	if !ok {
+		return "", errors.New("no client in context")
+	}
+	var sig string
+	err := c.CallContext(ctx, &sig, "signer_sign", data)
+	return sig, err
+}
+
+func (s *callbackService) Register(ctx context.Context) error {
+	c, ok := ClientFromContext(ctx)
+	if !ok {
+		return errors.New("no client in context")
+	}
+	return c.RegisterName("evil", new(signerService))
+}
+
+// 此测试检查服务器是否能通过同一个连接调用客户端注册的服务。
+func TestClientCallback(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	if err := server.RegisterName("cb", new(callbackService)); err != nil {
+		t.Fatal(err)
+	}
+	httpsrv := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	defer httpsrv.Close()
+	wsURL := "ws:" + strings.TrimPrefix(httpsrv.URL, "http:")
+
+	wsClient, err := DialWebsocket(context.Background(), wsURL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wsClient.Close()
+	inprocClient := DialInProc(server)
+	defer inprocClient.Close()
+
+	for name, client := range map[string]*Client{"ws": wsClient, "inproc": inprocClient} {
+		if err := client.RegisterName("signer", new(signerService)); err != nil {
+			t.Fatal(err)
+		}
+		var sig string
+		if err := client.Call(&sig, "cb_sign", "hello"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if sig != "signed:hello" {
+			t.Fatalf("%s: wrong result %q", name, sig)
+		}
+		// 服务器端的连接不能注册服务，否则它们会被加入服务器。
+		if err := client.Call(nil, "cb_register"); err == nil || err.Error() != errServerSideRegister.Error() {
+			t.Fatalf("%s: wrong error for server-side register: %v", name, err)
+		}
+	}
+	if err := inprocClient.Call(nil, "evil_sign", "x"); err == nil {
+		t.Fatal("service registered through server-side connection is callable")
+	}
+
+	// HTTP 请求没有可以回调的客户端。
+	httpsrv2 := httptest.NewServer(server)
+	defer httpsrv2.Close()
+	httpClient, err := DialHTTP(httpsrv2.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpClient.Close()
+	if err := httpClient.Call(nil, "cb_sign", "hello"); err == nil || err.Error() != "no client in context" {
+		t.Fatalf("wrong error over HTTP: %v", err)
+	}
+}
+
+// 此测试检查上下文的截止时间是否会中止调用。
+func TestClientContextDeadline(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := client.CallContext(ctx, nil, "test_block")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// 超时的调用不应影响后续的调用。
+	var resp echoResult
+	if err := client.Call(&resp, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal("call after timeout failed:", err)
+	}
+}
+
+func TestClientCloseQuit(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	client.Close()
+
+	if err := client.Call(nil, "test_echo", "hello", 10, &echoArgs{"world"}); err != ErrClientQuit {
+		t.Fatalf("wrong error %v, want %v", err, ErrClientQuit)
+	}
+}
+
+// 此测试检查请求 ID 是否按顺序分配。
+func TestClientIDs(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	client, err := newClient(context.Background(), func(context.Context) (ServerCodec, error) {
+		return NewCodec(p2), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 假服务器把请求 ID 作为结果返回。
+	go func() {
+		dec := json.NewDecoder(p1)
+		enc := json.NewEncoder(p1)
+		for {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return
+			}
+			msgs, batch := parseMessage(raw)
+			resps := make([]*jsonrpcMessage, len(msgs))
+			for i, msg := range msgs {
+				resps[i] = &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: msg.ID}
+			}
+			var err error
+			if batch {
+				err = enc.Encode(resps)
+			} else {
+				err = enc.Encode(resps[0])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for want := 1; want <= 3; want++ {
+		var id int
+		if err := client.Call(&id, "test_id"); err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Fatalf("wrong request ID %d, want %d", id, want)
+		}
+	}
+	batch := []BatchElem{
+		{Method: "test_id", Result: new(int)},
+		{Method: "test_id", Result: new(int)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	for i, elem := range batch {
+		if want := 4 + i; *elem.Result.(*int) != want {
+			t.Fatalf("batch element %d: wrong request ID %d, want %d", i, *elem.Result.(*int), want)
+		}
+	}
+}
+
+// 此测试检查既没有结果也没有错误的响应是否会产生 ErrNoResult。
+func TestClientNoResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg jsonrpcMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		w.Header().Set("content-type", contentType)
+		io.WriteString(w, `{"jsonrpc":"2.0","id":`+string(msg.ID)+"}")
+	}))
+	defer srv.Close()
+
+	client, err := DialHTTP(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Call(nil, "test_noResult"); err != ErrNoResult {
+		t.Fatalf("wrong error %v, want %v", err, ErrNoResult)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	startServer := func(addr string) (*Server, net.Listener) {
+		srv := newTestServer()
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Fatal("can't listen:", err)
+		}
+		go http.Serve(l, srv.WebsocketHandler([]string{"*"}))
+		return srv, l
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+	defer cancel()
+
+	// 启动服务器并连接客户端。
+	s1, l1 := startServer("127.0.0.1:0")
+	client, err := DialContext(ctx, "ws://"+l1.Addr().String())
+	if err != nil {
+		t.Fatal("can't dial", err)
+	}
+	defer client.Close()
+	var resp echoResult
+	if err := client.CallContext(ctx, &resp, "test_echo", "", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 发起一个阻塞的调用，然后停止服务器。
+	inflight := make(chan error, 1)
+	go func() { inflight <- client.CallContext(ctx, nil, "test_block") }()
+	time.Sleep(100 * time.Millisecond)
+	l1.Close()
+	s1.Stop()
+
+	// 进行中的调用应该以 errDead 失败。
+	if err := <-inflight; !errors.Is(err, errDead) {
+		t.Fatalf("wrong error for in-flight call: %v", err)
+	}
+	// 服务器停止时，调用会一直尝试重连，直到上下文结束。
+	downCtx, downCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer downCancel()
+	if err := client.CallContext(downCtx, &resp, "test_echo", "", 2, nil); err == nil {
+		t.Fatal("no error for call with server stopped")
+	}
+
+	// 在同一地址上重新启动服务器，调用应该透明地重连。
+	s2, l2 := startServer(l1.Addr().String())
+	defer l2.Close()
+	defer s2.Stop()
+
+	if err := client.CallContext(ctx, &resp, "test_echo", "", 3, nil); err != nil {
+		t.Fatal("call after restart failed:", err)
+	}
+	if resp.Int != 3 {
+		t.Fatalf("wrong result %+v", resp)
+	}
+}
+
+// 此测试检查重连尝试之间的等待时间是否按指数增长并受上限约束。
+func TestClientReconnectBackoff(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	var (
+		dials []time.Time
+		fails = 5
+		conn  ServerCodec
+	)
+	client, err := newClient(context.Background(), func(context.Context) (ServerCodec, error) {
+		dials = append(dials, time.Now())
+		if len(dials) > 1 && len(dials) <= fails+1 {
+			return nil, errors.New("dial failed")
+		}
+		p1, p2 := net.Pipe()
+		go server.ServeCodec(NewCodec(p1), 0)
+		conn = NewCodec(p2)
+		return conn, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetMaxReconnectBackoff(200 * time.Millisecond)
+
+	// 关闭当前连接，迫使下一次调用重连。
+	conn.close()
+	var resp echoResult
+	if err := client.Call(&resp, "test_echo", "", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(dials) != fails+2 {
+		t.Fatalf("wrong number of dials %d, want %d", len(dials), fails+2)
+	}
+	// 等待时间应为 100ms、200ms，之后保持在 200ms 上限。
+	want := []time.Duration{100, 200, 200, 200, 200}
+	for i, w := range want {
+		got := dials[i+2].Sub(dials[i+1])
+		if w *= time.Millisecond; got < w || got > w+150*time.Millisecond {
+			t.Errorf("backoff %d: got %v, want %v", i, got, w)
+		}
+	}
+}
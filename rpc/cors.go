@@ -0,0 +1,121 @@
+package rpc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// corsMaxAge 是浏览器可以缓存预检结果的秒数。
+const corsMaxAge = 600
+
+// corsAllowedMethods 是跨域请求可以使用的 HTTP 方法。
+var corsAllowedMethods = []string{http.MethodPost, http.MethodGet}
+
+// corsHandler 是一个 http.Handler，它为允许的源添加 CORS 头部并回答预检请求。
+type corsHandler struct {
+	allowAll bool
+	origins  []string // 小写的源，可以包含一个 '*' 通配符
+	next     http.Handler
+}
+
+// NewCORSHandler 创建一个 http.Handler，它允许来自 allowedOrigins 的浏览器
+// 跨域调用 next。'*' 允许所有的源。源中可以包含一个通配符，
+// 例如 "https://*.example.com"。
+//
+// 预检（OPTIONS）请求由此处理程序直接回答。不允许的源的请求
+// 仍然被交给 next，但响应不包含 CORS 头部，所以浏览器不会
+// 把响应交给页面。
+func NewCORSHandler(allowedOrigins []string, next http.Handler) http.Handler {
+	h := &corsHandler{next: next}
+	for _, origin := range allowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch origin {
+		case "":
+		case "*":
+			h.allowAll = true
+		default:
+			h.origins = append(h.origins, origin)
+		}
+	}
+	return h
+}
+
+// ServeHTTP 实现 http.Handler。
+func (h *corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		h.handlePreflight(w, r)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		w.Header().Add("Vary", "Origin")
+		if h.originAllowed(origin) && methodAllowed(r.Method) {
+			h.setAllowOrigin(w, origin)
+		}
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// handlePreflight 为允许的预检请求设置 CORS 头部。
+func (h *corsHandler) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if origin == "" || !h.originAllowed(origin) || !methodAllowed(method) {
+		return
+	}
+	h.setAllowOrigin(w, origin)
+	header.Set("Access-Control-Allow-Methods", method)
+	// 允许所有请求头部，例如 Content-Type 和 Authorization。
+	if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		header.Set("Access-Control-Allow-Headers", headers)
+	}
+	header.Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+}
+
+func (h *corsHandler) setAllowOrigin(w http.ResponseWriter, origin string) {
+	if h.allowAll {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+}
+
+// originAllowed 报告给定的源是否被允许。
+func (h *corsHandler) originAllowed(origin string) bool {
+	if h.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range h.origins {
+		if matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin 将源与可能包含一个 '*' 通配符的模式进行匹配。
+func matchOrigin(pattern, origin string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 {
+		return pattern == origin
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	return len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+func methodAllowed(method string) bool {
+	for _, m := range corsAllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
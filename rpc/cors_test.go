@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testCallBody = `{"jsonrpc":"2.0","id":1,"method":"rpc_modules"}`
+
+func TestCORSPreflight(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	httpsrv := httptest.NewServer(NewCORSHandler([]string{"https://wallet.example", "https://*.dapp.example"}, server))
+	defer httpsrv.Close()
+
+	tests := []struct {
+		origin, method string
+		wantOrigin     string
+	}{
+		{"https://wallet.example", "POST", "https://wallet.example"},
+		{"https://WALLET.example", "POST", "https://WALLET.example"},
+		{"https://app.dapp.example", "POST", "https://app.dapp.example"},
+		{"https://dapp.example", "POST", ""},
+		{"https://evil.example", "POST", ""},
+		{"https://wallet.example", "DELETE", ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodOptions, httpsrv.URL, nil)
+		req.Header.Set("Origin", test.origin)
+		req.Header.Set("Access-Control-Request-Method", test.method)
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("%s %s: wrong status %d", test.origin, test.method, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != test.wantOrigin {
+			t.Errorf("%s %s: wrong allowed origin %q, want %q", test.origin, test.method, got, test.wantOrigin)
+		}
+		if test.wantOrigin == "" {
+			continue
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Headers"); got != "content-type" {
+			t.Errorf("%s: wrong allowed headers %q", test.origin, got)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Methods"); got != test.method {
+			t.Errorf("%s: wrong allowed methods %q", test.origin, got)
+		}
+		if got := resp.Header.Get("Access-Control-Max-Age"); got != "600" {
+			t.Errorf("%s: wrong max age %q", test.origin, got)
+		}
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	tests := []struct {
+		allowed    []string
+		origin     string
+		wantOrigin string
+	}{
+		{[]string{"https://wallet.example"}, "https://wallet.example", "https://wallet.example"},
+		{[]string{"https://wallet.example"}, "https://evil.example", ""},
+		{[]string{"*"}, "https://anything.example", "*"},
+		{nil, "https://wallet.example", ""},
+		{[]string{"*"}, "", ""},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testCallBody))
+		req.Header.Set("content-type", contentType)
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		NewCORSHandler(test.allowed, server).ServeHTTP(rec, req)
+
+		// 请求总是被处理，只有 CORS 头部不同。
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"result"`) {
+			t.Errorf("%v %s: request not served: %d %s", test.allowed, test.origin, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != test.wantOrigin {
+			t.Errorf("%v %s: wrong allowed origin %q, want %q", test.allowed, test.origin, got, test.wantOrigin)
+		}
+	}
+}
+
+func TestVHostHandler(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	tests := []struct {
+		vhosts []string
+		host   string
+		want   int
+	}{
+		{[]string{"localhost"}, "localhost:8545", http.StatusOK},
+		{[]string{"localhost"}, "LOCALHOST", http.StatusOK},
+		{[]string{"localhost"}, "evil.example:8545", http.StatusForbidden},
+		{[]string{"localhost"}, "127.0.0.1:8545", http.StatusOK},
+		{[]string{"localhost"}, "[::1]:8545", http.StatusOK},
+		{[]string{"node.example"}, "node.example", http.StatusOK},
+		{[]string{"*"}, "evil.example", http.StatusOK},
+		{nil, "localhost", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testCallBody))
+		req.Header.Set("content-type", contentType)
+		req.Host = test.host
+		NewVHostHandler(test.vhosts, server).ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("%v %s: wrong status %d, want %d", test.vhosts, test.host, rec.Code, test.want)
+		}
+	}
+}
+
+// 此测试检查预检请求在 JWT 检查之前被回答，而实际请求仍需要令牌。
+func TestHTTPHandlerStack(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	endpoint := server.Endpoint([]string{"test"})
+	handler, err := NewHTTPHandlerStack(endpoint, []string{"https://wallet.example"}, []string{"*"}, testJWTSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpsrv := httptest.NewServer(handler)
+	defer httpsrv.Close()
+
+	req, _ := http.NewRequest(http.MethodOptions, httpsrv.URL, nil)
+	req.Header.Set("Origin", "https://wallet.example")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "https://wallet.example" {
+		t.Fatalf("preflight failed: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	client, _ := DialHTTP(httpsrv.URL)
+	if err := client.Call(nil, "test_noArgsRets"); err == nil {
+		t.Fatal("call without token succeeded")
+	}
+	client, _ = DialHTTPWithAuth(httpsrv.URL, newTestJWTAuth(t, testJWTSecret))
+	if err := client.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatal("call with token failed:", err)
+	}
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// Endpoint 是只提供服务器部分命名空间的入口。同一个服务器可以为不同的
+// 传输创建不同的入口，例如在 HTTP 上只提供 eth 和 net，而在 IPC 上提供
+// 所有命名空间。
+//
+// 对入口不提供的命名空间的调用会得到与方法不存在时相同的错误，
+// rpc_modules 和 rpc_discover 也只列出入口提供的命名空间。
+// rpc 命名空间总是可用的。
+type Endpoint struct {
+	server  *Server
+	modules moduleSet
+}
+
+// Endpoint 返回只提供给定命名空间的服务器入口。
+func (s *Server) Endpoint(modules []string) *Endpoint {
+	set := make(moduleSet, len(modules))
+	for _, name := range modules {
+		set[name] = true
+	}
+	return &Endpoint{server: s, modules: set}
+}
+
+// ServeCodec 与 Server.ServeCodec 相同，但只提供入口的命名空间。
+func (e *Endpoint) ServeCodec(codec ServerCodec, options CodecOption) {
+	e.server.serveCodec(codec, e.modules)
+}
+
+// ServeHTTP 与 Server.ServeHTTP 相同，但只提供入口的命名空间。
+func (e *Endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.server.serveHTTP(w, r, e.modules)
+}
+
+// WebsocketHandler 与 Server.WebsocketHandler 相同，但只提供入口的命名空间。
+func (e *Endpoint) WebsocketHandler(allowedOrigins []string) http.Handler {
+	return e.server.websocketHandler(allowedOrigins, e.modules)
+}
+
+// ServeListener 与 Server.ServeListener 相同，但只提供入口的命名空间。
+func (e *Endpoint) ServeListener(l net.Listener) error {
+	return e.server.serveListener(l, e.modules)
+}
+
+// IPCEndpoint 与 Server.IPCEndpoint 相同，但只提供入口的命名空间。
+func (e *Endpoint) IPCEndpoint(endpoint string) (net.Listener, error) {
+	return e.server.ipcEndpoint(endpoint, e.modules)
+}
+
+// moduleSet 是入口提供的命名空间的集合。nil 集合表示提供所有命名空间。
+type moduleSet map[string]bool
+
+// allows 报告集合是否包含给定的命名空间。
+func (m moduleSet) allows(namespace string) bool {
+	return m == nil || namespace == MetadataApi || m[namespace]
+}
+
+type moduleSetKey struct{}
+
+// modulesFromContext 返回处理当前调用的入口提供的命名空间。
+func modulesFromContext(ctx context.Context) moduleSet {
+	m, _ := ctx.Value(moduleSetKey{}).(moduleSet)
+	return m
+}
@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dialEndpoint 创建一个通过内存管道连接到入口的客户端。
+func dialEndpoint(e *Endpoint) *Client {
+	c, _ := newClient(context.Background(), func(context.Context) (ServerCodec, error) {
+		p1, p2 := net.Pipe()
+		go e.ServeCodec(NewCodec(p1), 0)
+		return NewCodec(p2), nil
+	})
+	return c
+}
+
+func TestEndpointModules(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	endpoint := server.Endpoint([]string{"test"})
+	httpsrv := httptest.NewServer(endpoint)
+	defer httpsrv.Close()
+
+	httpClient, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := map[string]*Client{"pipe": dialEndpoint(endpoint), "http": httpClient}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			defer client.Close()
+
+			var result echoResult
+			if err := client.Call(&result, "test_echo", "x", 1, nil); err != nil {
+				t.Fatal("call to allowed namespace failed:", err)
+			}
+
+			// 隐藏的命名空间中的方法就像不存在一样。
+			for _, method := range []string{"nftest_echo", "nftest_subscribe", "nftest_unsubscribe"} {
+				err := client.Call(nil, method, 1)
+				var rpcErr Error
+				if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != -32601 {
+					t.Fatalf("%s: wrong error %v", method, err)
+				}
+				if want := (&methodNotFoundError{method}).Error(); err.Error() != want {
+					t.Fatalf("%s: wrong error message %q, want %q", method, err, want)
+				}
+			}
+
+			var modules map[string]string
+			if err := client.Call(&modules, "rpc_modules"); err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{"rpc": "1.0", "test": "1.0"}; !reflect.DeepEqual(modules, want) {
+				t.Errorf("wrong modules %v, want %v", modules, want)
+			}
+
+			var doc OpenRPCDocument
+			if err := client.Call(&doc, "rpc_discover"); err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range doc.Methods {
+				if strings.HasPrefix(m.Name, "nftest_") {
+					t.Errorf("hidden method %s listed in rpc_discover", m.Name)
+				}
+			}
+			if len(doc.Subscriptions) != 0 {
+				t.Errorf("hidden subscriptions listed in rpc_discover: %v", doc.Subscriptions)
+			}
+		})
+	}
+
+	// 服务器本身提供所有命名空间。
+	client := DialInProc(server)
+	defer client.Close()
+	var modules map[string]string
+	if err := client.Call(&modules, "rpc_modules"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := modules["nftest"]; !ok {
+		t.Errorf("nftest missing from full server modules %v", modules)
+	}
+	if err := client.Call(nil, "nftest_echo", 1); err != nil {
+		t.Error("call on full server failed:", err)
+	}
+}
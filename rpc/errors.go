@@ -55,18 +55,23 @@ var (
 	_ Error = new(invalidMessageError)
 	_ Error = new(invalidParamsError)
 	_ Error = new(internalServerError)
+	_ Error = new(limitExceededError)
 )
 
 const (
 	errcodeDefault                  = -32000
 	errcodeNotificationsUnsupported = -32001
 	errcodeTimeout                  = -32002
+	errcodeResponseTooLarge         = -32003
+	errcodeLimitExceeded            = -32005
 	errcodePanic                    = -32603
 	errcodeMarshalError             = -32603
 )
 
 const (
-	errMsgTimeout = "request timed out"
+	errMsgTimeout          = "request timed out"
+	errMsgResponseTooLarge = "response too large"
+	errMsgBatchTooLarge    = "batch too large"
 )
 
 type methodNotFoundError struct{ method string }
@@ -121,4 +126,11 @@ type internalServerError struct {
 
 func (e *internalServerError) ErrorCode() int { return e.code }
 
-func (e *internalServerError) Error() string { return e.message }
\ No newline at end of file
+func (e *internalServerError) Error() string { return e.message }
+
+// limitExceededError is returned when a call is rejected by the server's limits.
+type limitExceededError struct{ message string }
+
+func (e *limitExceededError) ErrorCode() int { return errcodeLimitExceeded }
+
+func (e *limitExceededError) Error() string { return e.message }
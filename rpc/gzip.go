@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipMinLength 是压缩响应的最小字节数。更小的响应压缩后几乎不会变小，
+// 不值得花费 CPU 时间。
+const gzipMinLength = 1024
+
+var gzPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// acceptsGzip 报告 HTTP 请求是否接受 gzip 编码的响应。
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("accept-encoding"), ",") {
+		enc = strings.TrimSpace(enc)
+		if i := strings.IndexByte(enc, ';'); i >= 0 {
+			if q := strings.TrimSpace(enc[i+1:]); q == "q=0" || q == "q=0.0" {
+				continue
+			}
+			enc = strings.TrimSpace(enc[:i])
+		}
+		if strings.EqualFold(enc, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter 在响应达到 gzipMinLength 字节时用 gzip 压缩响应。
+// 在此之前，写入的数据被缓冲，以便决定是否压缩。如果处理程序设置了
+// Content-Length 头部，则直接根据它决定。
+type gzipResponseWriter struct {
+	resp http.ResponseWriter
+
+	status  int
+	buf     []byte
+	decided bool         // 是否已经决定了是否压缩
+	gz      *gzip.Writer // 压缩时不为 nil
+}
+
+func newGzipResponseWriter(w http.ResponseWriter) *gzipResponseWriter {
+	return &gzipResponseWriter{resp: w}
+}
+
+func (w *gzipResponseWriter) Header() http.Header {
+	return w.resp.Header()
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.decided {
+		return
+	}
+	w.status = status
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if cl := w.resp.Header().Get("content-length"); cl != "" {
+			n, _ := strconv.Atoi(cl)
+			w.decide(n >= gzipMinLength)
+		} else if len(w.buf)+len(b) < gzipMinLength {
+			w.buf = append(w.buf, b...)
+			return len(b), nil
+		} else {
+			w.decide(true)
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.resp.Write(b)
+}
+
+// Flush 发送目前为止写入的所有数据。如果还没有决定是否压缩，
+// 则不压缩响应。
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.resp.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide 写出响应头部和缓冲的数据。
+func (w *gzipResponseWriter) decide(compress bool) {
+	w.decided = true
+	if compress {
+		h := w.resp.Header()
+		h.Del("content-length")
+		h.Set("content-encoding", "gzip")
+		w.gz = gzPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.resp)
+	}
+	if w.status != 0 {
+		w.resp.WriteHeader(w.status)
+	}
+	if len(w.buf) > 0 {
+		if w.gz != nil {
+			w.gz.Write(w.buf)
+		} else {
+			w.resp.Write(w.buf)
+		}
+		w.buf = nil
+	}
+}
+
+// close 结束响应。它必须在处理程序返回之后调用。
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		w.gz.Reset(io.Discard)
+		gzPool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// gzipReadCloser 解码 gzip 编码的响应体。
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.body.Close()
+}
+
+// responseBody 返回 HTTP 响应的响应体，如果响应是 gzip 编码的，则对其解码。
+func responseBody(resp *http.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(resp.Header.Get("content-encoding"), "gzip") {
+		return resp.Body, nil
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: gz, body: resp.Body}, nil
+}
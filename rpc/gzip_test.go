@@ -0,0 +1,139 @@
+package rpc
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip", true},
+		{"GZIP;q=0.5", true},
+		{"gzip;q=0", false},
+		{"identity", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("accept-encoding", test.header)
+		if got := acceptsGzip(r); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestHTTPGzip(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	post := func(body, acceptEncoding string) (*http.Response, string) {
+		req, _ := http.NewRequest("POST", httpsrv.URL, strings.NewReader(body))
+		req.Header.Set("content-type", contentType)
+		if acceptEncoding != "" {
+			req.Header.Set("accept-encoding", acceptEncoding)
+		}
+		// 使用不会自动解码响应的传输。
+		resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var r io.Reader = resp.Body
+		if resp.Header.Get("content-encoding") == "gzip" {
+			gz, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gz
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(data)
+	}
+	large := `{"jsonrpc":"2.0","id":1,"method":"test_repeat","params":["x",5000]}`
+	small := `{"jsonrpc":"2.0","id":1,"method":"test_repeat","params":["x",10]}`
+
+	// 大响应被压缩。
+	resp, body := post(large, "gzip")
+	if resp.Header.Get("content-encoding") != "gzip" {
+		t.Fatal("large response not compressed")
+	}
+	if !strings.Contains(body, strings.Repeat("x", 5000)) {
+		t.Fatalf("wrong decompressed body %.100s", body)
+	}
+	if !strings.Contains(resp.Header.Get("vary"), "accept-encoding") {
+		t.Error("missing vary header")
+	}
+
+	// 小响应不压缩。
+	resp, body = post(small, "gzip")
+	if resp.Header.Get("content-encoding") != "" {
+		t.Error("small response compressed")
+	}
+	if want := `{"jsonrpc":"2.0","id":1,"result":"xxxxxxxxxx"}` + "\n"; body != want {
+		t.Errorf("wrong body %q, want %q", body, want)
+	}
+
+	// 不接受 gzip 的客户端得到未压缩的响应。
+	resp, body = post(large, "")
+	if resp.Header.Get("content-encoding") != "" {
+		t.Error("response compressed without accept-encoding")
+	}
+	if !strings.Contains(body, strings.Repeat("x", 5000)) {
+		t.Fatalf("wrong body %.100s", body)
+	}
+}
+
+func TestHTTPClientGzip(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	encodings := make(chan string, 10)
+	httpsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.ServeHTTP(w, r)
+		encodings <- w.Header().Get("content-encoding")
+	}))
+	defer httpsrv.Close()
+
+	// 即使传输不会自动解码，客户端也能处理压缩的响应。
+	client, err := DialHTTPWithClient(httpsrv.URL, &http.Client{Transport: &http.Transport{DisableCompression: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var result string
+	if err := client.Call(&result, "test_repeat", "y", 3000); err != nil {
+		t.Fatal(err)
+	}
+	if result != strings.Repeat("y", 3000) {
+		t.Fatalf("wrong result %.100s", result)
+	}
+	if enc := <-encodings; enc != "gzip" {
+		t.Fatalf("response not compressed, content-encoding %q", enc)
+	}
+
+	batch := []BatchElem{
+		{Method: "test_repeat", Args: []interface{}{"a", 2000}, Result: new(string)},
+		{Method: "test_repeat", Args: []interface{}{"b", 2000}, Result: new(string)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	for i, elem := range batch {
+		if elem.Error != nil || len(*elem.Result.(*string)) != 2000 {
+			t.Errorf("batch element %d: err %v", i, elem.Error)
+		}
+	}
+}
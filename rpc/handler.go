@@ -3,7 +3,7 @@ package rpc
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"flychain/log"
 	"reflect"
 	"strconv"
 	"strings"
@@ -43,11 +43,46 @@ type handler struct {
 	conn           jsonWriter                     // 响应将发送到哪里
 	log            log.Logger
 	allowSubscribe bool
+	limiter        *callLimiter // 服务器的调用限制，可能为 nil
+	activeCalls    int32        // 正在执行的请求数，由 limiter 维护
+
+	batchRequestLimit    int            // 批处理中的最大请求数，零表示不限制
+	batchResponseMaxSize int            // 批处理响应的最大字节数，零表示不限制
+	executionTimeout     time.Duration  // 单个请求的最长执行时间，零表示不限制
+	interceptors         []Interceptor  // 包装方法执行的拦截器
+	peer                 PeerInfo       // 连接对端的信息
+	metrics              *serverMetrics // 服务器的调用统计，可能为 nil
+	modules              moduleSet      // 连接可以使用的命名空间，nil 表示全部
 
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
 }
 
+// handlerConfig 包含服务器为其连接的处理程序设置的参数。
+type handlerConfig struct {
+	modules              moduleSet
+	limiter              *callLimiter
+	batchRequestLimit    int
+	batchResponseMaxSize int
+	executionTimeout     time.Duration
+	interceptors         []Interceptor
+	metrics              *serverMetrics
+}
+
+// configure 应用服务器的设置。cfg 为 nil 时什么也不做。
+func (h *handler) configure(cfg *handlerConfig) {
+	if cfg == nil {
+		return
+	}
+	h.limiter = cfg.limiter
+	h.batchRequestLimit = cfg.batchRequestLimit
+	h.batchResponseMaxSize = cfg.batchResponseMaxSize
+	h.executionTimeout = cfg.executionTimeout
+	h.interceptors = cfg.interceptors
+	h.metrics = cfg.metrics
+	h.modules = cfg.modules
+}
+
 type callProc struct {
 	ctx       context.Context
 	notifiers []*Notifier
@@ -113,13 +148,18 @@ func (b *batchCallBuffer) pushResponse(answer *jsonrpcMessage) {
 // 超时发送到目前为止添加的响应。对于剩余的未接电话
 // 消息，它发送超时错误响应。
 func (b *batchCallBuffer) timeout(ctx context.Context, conn jsonWriter) {
+	b.respondWithError(ctx, conn, &internalServerError{errcodeTimeout, errMsgTimeout})
+}
+
+// respondWithError 发送目前为止添加的响应。对于剩余的未处理的调用
+// 消息，它发送给定的错误响应。
+func (b *batchCallBuffer) respondWithError(ctx context.Context, conn jsonWriter, err error) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
 	for _, msg := range b.calls {
 		if !msg.isNotification() {
-			resp := msg.errResponse(&internalServerError{errcodeTimeout, errMsgTimeout})
-			b.resp = append(b.resp, resp)
+			b.resp = append(b.resp, msg.errResponse(err))
 		}
 	}
 	b.doWrite(ctx, conn, true)
@@ -137,25 +177,246 @@ func (b *batchCallBuffer) doWrite(ctx context.Context, conn jsonWriter, isErrorR
 	}
 }
 
+// write 发送目前为止添加的响应。
+func (b *batchCallBuffer) write(ctx context.Context, conn jsonWriter) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.doWrite(ctx, conn, false)
+}
+
 // handleBatch 批量执行所有消息并返回响应。
 func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	// 为空批发出错误响应：
 	if len(msgs) == 0 {
+		h.startCallProc(func(cp *callProc) {
+			resp := errorMessage(&invalidRequestError{"empty batch"})
+			h.conn.writeJSON(cp.ctx, resp, true)
+		})
+		return
+	}
+	h.metrics.observeBatch(len(msgs))
+
+	// 限制批处理中的请求数。
+	if h.batchRequestLimit != 0 && len(msgs) > h.batchRequestLimit {
+		h.startCallProc(func(cp *callProc) {
+			h.respondWithBatchTooLarge(cp, msgs)
+		})
+		return
+	}
+
+	// 首先处理非调用消息：
+	calls := make([]*jsonrpcMessage, 0, len(msgs))
+	var resolved []*requestOp
+	for _, msg := range msgs {
+		if msg.isResponse() {
+			if op := h.respWait[string(msg.ID)]; op != nil {
+				resolved = append(resolved, op)
+			}
+		}
+		if handled := h.handleImmediate(msg); !handled {
+			calls = append(calls, msg)
+		}
+	}
+	h.failMissingResponses(resolved)
+	if len(calls) == 0 {
+		return
+	}
+	if !h.acquireCallSlot(calls, true) {
+		return
+	}
+	// 在 goroutine 上处理调用，因为它们可能会无限期阻塞：
+	h.startCallProc(func(cp *callProc) {
+		defer h.releaseCallSlot()
+		var (
+			timer         *time.Timer
+			cancel        context.CancelFunc
+			callBuffer    = &batchCallBuffer{calls: calls, resp: make([]*jsonrpcMessage, 0, len(calls))}
+			responseBytes int
+		)
+		cp.ctx, cancel = context.WithCancel(cp.ctx)
+		defer cancel()
+
+		// 超时后取消请求上下文并发送已完成调用的结果以及其余调用的超时错误。
+		if timeout, ok := h.requestTimeout(cp.ctx); ok {
+			timer = time.AfterFunc(timeout, func() {
+				// 先发送响应再取消，否则返回的方法可能抢先写入取消错误。
+				callBuffer.timeout(cp.ctx, h.conn)
+				cancel()
+			})
+		}
+
+		for {
+			// 超时后不再处理剩余的调用。
+			if cp.ctx.Err() != nil {
+				break
+			}
+			msg := callBuffer.nextCall()
+			if msg == nil {
+				break
+			}
+			resp := h.handleCallMsg(cp, msg)
+			callBuffer.pushResponse(resp)
+			if resp != nil && h.batchResponseMaxSize != 0 {
+				responseBytes += len(resp.Result)
+				if responseBytes > h.batchResponseMaxSize {
+					// 剩余的调用不再执行，它们都得到错误响应。
+					err := &internalServerError{errcodeResponseTooLarge, errMsgResponseTooLarge}
+					callBuffer.respondWithError(cp.ctx, h.conn, err)
+					break
+				}
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		h.addSubscriptions(cp.notifiers)
+		callBuffer.write(cp.ctx, h.conn)
+		for _, n := range cp.notifiers {
+			n.activate()
+		}
+	})
+}
 
+// respondWithBatchTooLarge 为超出请求数限制的批处理发送错误响应。
+// 协议无法为整个批处理报告错误，所以错误响应使用批处理中
+// 第一个调用的 ID。
+func (h *handler) respondWithBatchTooLarge(cp *callProc, batch []*jsonrpcMessage) {
+	resp := errorMessage(&invalidRequestError{errMsgBatchTooLarge})
+	for _, msg := range batch {
+		if msg.isCall() {
+			resp.ID = msg.ID
+			break
+		}
+	}
+	h.conn.writeJSON(cp.ctx, []*jsonrpcMessage{resp}, true)
+}
+
+// failMissingResponses 结束收到了批处理响应但仍有请求没有得到回复的请求操作。
+// 服务器在批处理超出限制时可能只回复部分请求，剩余的请求不会再有响应。
+func (h *handler) failMissingResponses(ops []*requestOp) {
+	for _, op := range ops {
+		var missing bool
+		for _, id := range op.ids {
+			if h.respWait[string(id)] == op {
+				missing = true
+			}
+		}
+		if missing {
+			h.removeRequestOp(op)
+			op.err = ErrMissingBatchResponse
+			close(op.resp)
+		}
 	}
 }
 
 // handleMsg 处理单个消息。
 func (h *handler) handleMsg(msg *jsonrpcMessage) {
-	//if ok := h.handleIm
+	if ok := h.handleImmediate(msg); ok {
+		return
+	}
+	if !h.acquireCallSlot([]*jsonrpcMessage{msg}, false) {
+		return
+	}
+	h.startCallProc(func(cp *callProc) {
+		defer h.releaseCallSlot()
+		var (
+			responded sync.Once
+			timer     *time.Timer
+			cancel    context.CancelFunc
+		)
+		cp.ctx, cancel = context.WithCancel(cp.ctx)
+		defer cancel()
+
+		// 超时后取消请求上下文并发送错误响应。正在运行的方法可能不会
+		// 在超时后立即返回，所以必须在处理请求的同时等待超时。
+		if timeout, ok := h.requestTimeout(cp.ctx); ok {
+			timer = time.AfterFunc(timeout, func() {
+				// 先发送响应再取消，否则返回的方法可能抢先写入取消错误。
+				if !msg.isNotification() {
+					responded.Do(func() {
+						resp := msg.errResponse(&internalServerError{errcodeTimeout, errMsgTimeout})
+						h.conn.writeJSON(cp.ctx, resp, true)
+					})
+				}
+				cancel()
+			})
+		}
+
+		answer := h.handleCallMsg(cp, msg)
+		if timer != nil {
+			timer.Stop()
+		}
+		h.addSubscriptions(cp.notifiers)
+		if answer != nil {
+			responded.Do(func() {
+				h.conn.writeJSON(cp.ctx, answer, false)
+			})
+		}
+		// 订阅 ID 已经发送，现在可以激活通知程序，
+		// 此前缓冲的通知会被发送出去。
+		for _, n := range cp.notifiers {
+			n.activate()
+		}
+	})
+}
+
+// requestTimeout 返回请求的最长执行时间。它是服务器设置的执行超时和
+// 从上下文得出的超时（参见 ContextRequestTimeout）中较小的一个。
+func (h *handler) requestTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ContextRequestTimeout(ctx)
+	if h.executionTimeout > 0 && (!ok || h.executionTimeout < timeout) {
+		return h.executionTimeout, true
+	}
+	return timeout, ok
+}
+
+// acquireCallSlot 在服务器的并发限制内为 msgs 占用一个执行槽。
+// 如果超出限制，则为其中的调用发送错误响应并返回 false。响应在单独的
+// goroutine 上写出，这样读取缓慢的对端不会阻塞连接的读取循环。
+func (h *handler) acquireCallSlot(msgs []*jsonrpcMessage, batch bool) bool {
+	if h.limiter == nil {
+		return true
+	}
+	err := h.limiter.acquire(h)
+	if err == nil {
+		return true
+	}
+	resps := make([]*jsonrpcMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		h.log.Warn("Rejected RPC call", "reqid", idForLog{msg.ID}, "method", msg.Method, "err", err)
+		if !msg.isNotification() {
+			resps = append(resps, msg.errResponse(err))
+		}
+	}
+	switch {
+	case len(resps) == 0:
+	case batch:
+		h.startCallProc(func(cp *callProc) {
+			h.conn.writeJSON(cp.ctx, resps, true)
+		})
+	default:
+		h.startCallProc(func(cp *callProc) {
+			h.conn.writeJSON(cp.ctx, resps[0], true)
+		})
+	}
+	return false
+}
+
+// releaseCallSlot 释放 acquireCallSlot 占用的执行槽。
+func (h *handler) releaseCallSlot() {
+	if h.limiter != nil {
+		h.limiter.release(h)
+	}
 }
 
 // close 取消除 inflightReq 之外的所有请求并等待
-// 调用 goroutines 关闭。
+// 调用 goroutines 关闭。根上下文在等待之前被取消，
+// 这样仍在运行的方法可以感知到连接已经关闭。
 func (h *handler) close(err error, inflightReq *requestOp) {
 	h.cancelAllRequests(err, inflightReq)
-	h.CallWG.Wait()
 	h.cancelRoot()
+	h.CallWG.Wait()
 	h.cancelServerSubscriptions(err)
 }
 
@@ -203,6 +464,7 @@ func (h *handler) addSubscriptions(nn []*Notifier) {
 	for _, n := range nn {
 		if sub := n.takeSubscription(); sub != nil {
 			h.serverSubs[sub.ID] = sub
+			h.metrics.addSubscriptions(sub.namespace, 1)
 		}
 	}
 }
@@ -216,6 +478,7 @@ func (h *handler) cancelServerSubscriptions(err error) {
 		s.err <- err
 		close(s.err)
 		delete(h.serverSubs, id)
+		h.metrics.addSubscriptions(s.namespace, -1)
 	}
 }
 
@@ -226,12 +489,16 @@ func (h *handler) startCallProc(fn func(*callProc)) {
 		ctx, cancel := context.WithCancel(h.rootGtx)
 		defer h.CallWG.Done()
 		defer cancel()
+		ctx = context.WithValue(ctx, peerInfoContextKey{}, h.peer)
+		if h.modules != nil {
+			ctx = context.WithValue(ctx, moduleSetKey{}, h.modules)
+		}
 		fn(&callProc{ctx: ctx})
 	}()
 }
 
 // handleImmediate 执行非调用消息。如果消息是一个调用或需要回复，它返回 false
-func (h *handler) handlerImmediate(msg *jsonrpcMessage) bool {
+func (h *handler) handleImmediate(msg *jsonrpcMessage) bool {
 	start := time.Now()
 	switch {
 	case msg.isNotification():
@@ -239,6 +506,7 @@ func (h *handler) handlerImmediate(msg *jsonrpcMessage) bool {
 			h.handleSubscriptionResult(msg)
 			return true
 		}
+		return false
 	case msg.isResponse():
 		h.handleResponse(msg)
 		h.log.Trace("Handled RPC response", "reqid", idForLog{msg.ID}, "duration", time.Since(start))
@@ -255,8 +523,11 @@ func (h *handler) handleSubscriptionResult(msg *jsonrpcMessage) {
 		h.log.Debug("Dropping invalid subscription message")
 		return
 	}
-	if h.clientSubs[result.ID] != nil {
-		h.clientSubs[result.ID].deliver(result.Result)
+	if sub := h.clientSubs[result.ID]; sub != nil {
+		if !sub.deliver(result.Result) {
+			// 订阅的转发循环已经退出，不再需要跟踪它。
+			delete(h.clientSubs, result.ID)
+		}
 	}
 }
 
@@ -271,7 +542,7 @@ func (h *handler) handleResponse(msg *jsonrpcMessage) {
 	// 对于正常响应，只需将响应转发给 Call/BatchCall。
 	if op.sub == nil {
 		op.resp <- msg
-		return 
+		return
 	}
 	// 对于订阅响应，如果服务器启动订阅
 	//表示成功。 EthSubscribe 在任何一种情况下都可以通过
@@ -279,29 +550,137 @@ func (h *handler) handleResponse(msg *jsonrpcMessage) {
 	defer close(op.resp)
 	if msg.Error != nil {
 		op.err = msg.Error
+		return
 	}
-	if op.err = json.Unmarshal(msg.Result, &op.sub.subid); op.err != nil {
+	if op.err = json.Unmarshal(msg.Result, &op.sub.subid); op.err == nil {
 		go op.sub.run()
 		h.clientSubs[op.sub.subid] = op.sub
 	}
 }
 
+// handleCallMsg 执行调用消息并返回答案。
+func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+	start := time.Now()
+	switch {
+	case msg.isNotification():
+		h.handleCall(ctx, msg)
+		h.log.Debug("Served "+msg.Method, "duration", time.Since(start))
+		return nil
+	case msg.isCall():
+		resp := h.handleCall(ctx, msg)
+		var ctx []interface{}
+		ctx = append(ctx, "reqid", idForLog{msg.ID}, "duration", time.Since(start))
+		if resp.Error != nil {
+			ctx = append(ctx, "err", resp.Error.Message)
+			if resp.Error.Data != nil {
+				ctx = append(ctx, "errdata", resp.Error.Data)
+			}
+			h.log.Warn("Served "+msg.Method, ctx...)
+		} else {
+			h.log.Debug("Served "+msg.Method, ctx...)
+		}
+		return resp
+	case msg.hasValidID():
+		return msg.errResponse(&invalidRequestError{"invalid request"})
+	default:
+		return errorMessage(&invalidRequestError{"invalid request"})
+	}
+}
+
+// handleCall 处理方法调用。
+func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+	// 入口不提供的命名空间中的方法就像不存在一样。
+	if !h.modules.allows(msg.namespace()) {
+		return msg.errResponse(&methodNotFoundError{method: msg.Method})
+	}
+	if h.limiter != nil {
+		if err := h.limiter.allow(msg.Method); err != nil {
+			h.log.Warn("Rejected RPC call", "reqid", idForLog{msg.ID}, "method", msg.Method, "err", err)
+			return msg.errResponse(err)
+		}
+	}
+	if msg.isSubscribe() {
+		return h.handleSubscribe(cp, msg)
+	}
+	var callb *callback
+	if msg.isUnsubscribe() {
+		callb = h.unsubscribeCb
+	} else {
+		callb = h.reg.callback(msg.Method)
+	}
+	if callb == nil {
+		return msg.errResponse(&methodNotFoundError{method: msg.Method})
+	}
+	args, err := parsePositionalArguments(msg.Params, callb.argTypes)
+	if err != nil {
+		return msg.errResponse(&invalidParamsError{err.Error()})
+	}
+	start := time.Now()
+	answer := h.runMethod(cp.ctx, msg, callb, args)
+	h.metrics.observeCall(h.metricsMethod(msg), answer.Error == nil, time.Since(start))
+	return answer
+}
+
+// metricsMethod 返回调用在统计信息中使用的方法名。任何命名空间的 *_unsubscribe
+// 调用都会被处理，为了避免产生无限多的标签，未注册的命名空间的取消订阅调用
+// 被统计为 unknownMethodLabel。订阅只能在已注册的命名空间中创建。
+func (h *handler) metricsMethod(msg *jsonrpcMessage) string {
+	if msg.isUnsubscribe() && !h.reg.hasService(msg.namespace()) {
+		return unknownMethodLabel
+	}
+	return msg.Method
+}
+
 // handleSubscribe 处理 *_subscribe 方法调用。
 func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
 	if !h.allowSubscribe {
 		return msg.errResponse(&internalServerError{
-			code: errcodeNotificationsUnsupported,
+			code:    errcodeNotificationsUnsupported,
 			message: ErrNotificationsUnsupported.Error(),
 		})
 	}
 
 	// 订阅方法名称是第一个参数。
-	//name, err := parseSub
+	name, err := parseSubscriptionName(msg.Params)
+	if err != nil {
+		return msg.errResponse(&invalidParamsError{err.Error()})
+	}
+	namespace := msg.namespace()
+	callb := h.reg.subscription(namespace, name)
+	if callb == nil {
+		return msg.errResponse(&subscriptionNotFoundError{namespace, name})
+	}
+
+	// 同时解析订阅名称参数，但在调用回调之前将其删除。
+	argTypes := append([]reflect.Type{stringType}, callb.argTypes...)
+	args, err := parsePositionalArguments(msg.Params, argTypes)
+	if err != nil {
+		return msg.errResponse(&invalidParamsError{err.Error()})
+	}
+	args = args[1:]
+
+	// 在上下文中安装通知程序，以便订阅处理程序可以找到它。
+	n := &Notifier{h: h, namespace: namespace}
+	cp.notifiers = append(cp.notifiers, n)
+	ctx := context.WithValue(cp.ctx, notifierKey{}, n)
+
+	start := time.Now()
+	answer := h.runMethod(ctx, msg, callb, args)
+	h.metrics.observeCall(msg.Method, answer.Error == nil, time.Since(start))
+	return answer
 }
 
 // runMethod 运行 RPC 方法的 Go 回调。
 func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
-	result, err := callb.call(ctx, msg.Method, args) 
+	var (
+		result interface{}
+		err    error
+	)
+	if len(h.interceptors) > 0 {
+		result, err = h.intercept(ctx, msg, callb, args)
+	} else {
+		result, err = callb.call(ctx, msg.Method, args)
+	}
 	if err != nil {
 		return msg.errResponse(err)
 	}
@@ -319,6 +698,7 @@ func (h *handler) unsubscribe(ctx context.Context, id ID) (bool, error) {
 	}
 	close(s.err)
 	delete(h.serverSubs, id)
+	h.metrics.addSubscriptions(s.namespace, -1)
 	return true, nil
 }
 
@@ -1,8 +1,20 @@
 package rpc
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flychain/log"
+	"fmt"
+	"io"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
+	"time"
 )
 
 const (
@@ -13,12 +25,371 @@ const (
 // https://www.jsonrpc.org/historical/json-rpc-over-http.html#id13
 var acceptedContentTypes = []string{contentType, "application/json-rpc", "application/jsonrequest"}
 
+// HTTPTimeouts 表示 HTTP RPC 服务器的超时配置。
+type HTTPTimeouts struct {
+	// ReadTimeout 是读取整个请求（包括请求体）的最长时间。
+	ReadTimeout time.Duration
+
+	// ReadHeaderTimeout 是读取请求头的时间。为零时使用 ReadTimeout。
+	ReadHeaderTimeout time.Duration
+
+	// WriteTimeout 是写出响应之前的最长时间。它同时限制了方法的执行时间：
+	// 超时前服务器会取消方法的执行并返回超时错误。
+	WriteTimeout time.Duration
+
+	// IdleTimeout 是启用 keep-alive 时等待下一个请求的最长时间。
+	// 为零时使用 ReadTimeout。
+	IdleTimeout time.Duration
+}
+
+// DefaultHTTPTimeouts 是 HTTP RPC 服务器的默认超时设置。
+var DefaultHTTPTimeouts = HTTPTimeouts{
+	ReadTimeout:       30 * time.Second,
+	ReadHeaderTimeout: 30 * time.Second,
+	WriteTimeout:      30 * time.Second,
+	IdleTimeout:       120 * time.Second,
+}
+
+// minHTTPTimeout 是 NewHTTPServer 接受的最小超时。
+const minHTTPTimeout = time.Second
+
+// NewHTTPServer 创建一个使用给定超时设置为 handler 提供服务的 HTTP 服务器。
+// 小于一秒的超时会被提高到一秒。
+func NewHTTPServer(handler http.Handler, timeouts HTTPTimeouts) *http.Server {
+	sanitize := func(name string, d *time.Duration) {
+		if *d < minHTTPTimeout {
+			log.Warn("Sanitizing invalid HTTP timeout", "type", name, "provided", *d, "updated", minHTTPTimeout)
+			*d = minHTTPTimeout
+		}
+	}
+	sanitize("read", &timeouts.ReadTimeout)
+	sanitize("read header", &timeouts.ReadHeaderTimeout)
+	sanitize("write", &timeouts.WriteTimeout)
+	sanitize("idle", &timeouts.IdleTimeout)
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       timeouts.ReadTimeout,
+		ReadHeaderTimeout: timeouts.ReadHeaderTimeout,
+		WriteTimeout:      timeouts.WriteTimeout,
+		IdleTimeout:       timeouts.IdleTimeout,
+	}
+}
+
+// ContextRequestTimeout 返回从给定上下文得出的请求超时。它考虑上下文的
+// 截止时间以及提供请求服务的 HTTP 服务器的 WriteTimeout。
+func ContextRequestTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout := time.Duration(math.MaxInt64)
+	hasTimeout := false
+	setTimeout := func(d time.Duration) {
+		if d < timeout {
+			timeout = d
+			hasTimeout = true
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		setTimeout(time.Until(deadline))
+	}
+
+	// 如果上下文属于 HTTP 请求，则使用服务器的 WriteTimeout。
+	httpSrv, ok := ctx.Value(http.ServerContextKey).(*http.Server)
+	if ok && httpSrv.WriteTimeout > 0 {
+		// 响应必须在 HTTP 服务器断开连接之前发出，
+		// 所以内部超时必须比服务器的实际超时早一些。
+		setTimeout(httpSrv.WriteTimeout - 100*time.Millisecond)
+	}
+	return timeout, hasTimeout
+}
+
+// httpConn 实现了 ServerCodec，但 Client 会对它做特殊处理，
+// 某些方法不起作用。这里的 panic() 桩用于确保这种特殊处理是正确的。
 type httpConn struct {
-	client *http.Client
-	url string
+	client    *http.Client
+	url       string
 	closeOnce sync.Once
-	closeCh chan interface{}
-	mu sync.Mutex //protects headers
-	headers http.Header
-	auth HTTPAuth
-}
\ No newline at end of file
+	closeCh   chan interface{}
+	mu        sync.Mutex //protects headers
+	headers   http.Header
+	auth      HTTPAuth
+}
+
+// HTTPAuth 在每次请求时被调用，可以修改请求的头部。
+type HTTPAuth func(h http.Header) error
+
+func (hc *httpConn) writeJSON(context.Context, interface{}, bool) error {
+	panic("writeJSON called on httpConn")
+}
+
+func (hc *httpConn) peerInfo() PeerInfo {
+	panic("peerInfo called on httpConn")
+}
+
+func (hc *httpConn) remoteAddr() string {
+	return hc.url
+}
+
+func (hc *httpConn) readBatch() ([]*jsonrpcMessage, bool, error) {
+	<-hc.closeCh
+	return nil, false, io.EOF
+}
+
+func (hc *httpConn) close() {
+	hc.closeOnce.Do(func() { close(hc.closeCh) })
+}
+
+func (hc *httpConn) closed() <-chan interface{} {
+	return hc.closeCh
+}
+
+// DialHTTPWithClient 创建一个新的 RPC 客户端，它使用给定的 HTTP 客户端
+// 通过 HTTP 连接到 RPC 服务器。
+func DialHTTPWithClient(endpoint string, client *http.Client) (*Client, error) {
+	return dialHTTP(endpoint, client, nil)
+}
+
+// DialHTTPWithAuth 创建一个新的 RPC 客户端，它通过 HTTP 连接到 RPC 服务器，
+// 并在发送每个请求之前调用 auth 设置身份验证头。
+func DialHTTPWithAuth(endpoint string, auth HTTPAuth) (*Client, error) {
+	return dialHTTP(endpoint, new(http.Client), auth)
+}
+
+func dialHTTP(endpoint string, client *http.Client, auth HTTPAuth) (*Client, error) {
+	// 检查 URL，这样我们就不会得到一个每次请求都失败的客户端。
+	_, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	initctx := context.Background()
+	headers := make(http.Header, 3)
+	headers.Set("accept", contentType)
+	headers.Set("accept-encoding", "gzip")
+	headers.Set("content-type", contentType)
+	return newClient(initctx, func(context.Context) (ServerCodec, error) {
+		hc := &httpConn{
+			client:  client,
+			headers: headers,
+			url:     endpoint,
+			auth:    auth,
+			closeCh: make(chan interface{}),
+		}
+		return hc, nil
+	})
+}
+
+// DialHTTP 创建一个新的 RPC 客户端，它通过 HTTP 连接到 RPC 服务器。
+func DialHTTP(endpoint string) (*Client, error) {
+	return DialHTTPWithClient(endpoint, new(http.Client))
+}
+
+func (c *Client) sendHTTP(ctx context.Context, op *requestOp, msg interface{}) error {
+	hc := c.writeConn.(*httpConn)
+	respBody, err := hc.doRequest(ctx, msg)
+	if err != nil {
+		return err
+	}
+	defer respBody.Close()
+
+	var respmsg jsonrpcMessage
+	if err := json.NewDecoder(respBody).Decode(&respmsg); err != nil {
+		return err
+	}
+	op.resp <- &respmsg
+	return nil
+}
+
+func (c *Client) sendBatchHTTP(ctx context.Context, op *requestOp, msgs []*jsonrpcMessage) error {
+	hc := c.writeConn.(*httpConn)
+	respBody, err := hc.doRequest(ctx, msgs)
+	if err != nil {
+		return err
+	}
+	defer respBody.Close()
+
+	var respmsgs []jsonrpcMessage
+	if err := json.NewDecoder(respBody).Decode(&respmsgs); err != nil {
+		return err
+	}
+	if len(respmsgs) > len(msgs) {
+		return fmt.Errorf("batch has %d requests but response has %d elements", len(msgs), len(respmsgs))
+	}
+	for i := 0; i < len(respmsgs); i++ {
+		op.resp <- &respmsgs[i]
+	}
+	// 之后的等待会得到 ErrMissingBatchResponse。
+	op.err = ErrMissingBatchResponse
+	close(op.resp)
+	return nil
+}
+
+func (hc *httpConn) doRequest(ctx context.Context, msg interface{}) (io.ReadCloser, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", hc.url, io.NopCloser(bytes.NewReader(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+
+	// 设置头部
+	hc.mu.Lock()
+	req.Header = hc.headers.Clone()
+	hc.mu.Unlock()
+	if hc.auth != nil {
+		if err := hc.auth(req.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	// 执行请求
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// 我们自己设置了 Accept-Encoding，所以 http.Transport 不会解码响应。
+	respBody, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var buf bytes.Buffer
+		var body []byte
+		if _, err := buf.ReadFrom(respBody); err == nil {
+			body = buf.Bytes()
+		}
+		respBody.Close()
+		return nil, HTTPError{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Body:       body,
+		}
+	}
+	return respBody, nil
+}
+
+// httpServerConn 将 HTTP 连接转换为 Conn。
+type httpServerConn struct {
+	io.Reader
+	io.Writer
+	r *http.Request
+}
+
+func newHTTPServerConn(r *http.Request, w http.ResponseWriter) ServerCodec {
+	body := io.LimitReader(r.Body, maxRequestContentLength)
+	conn := &httpServerConn{Reader: body, Writer: w, r: r}
+
+	encoder := func(v interface{}, isErrorResponse bool) error {
+		if !isErrorResponse {
+			return json.NewEncoder(conn).Encode(v)
+		}
+
+		// 这是一个错误响应，需要特殊处理。
+		//
+		// 在超时错误的情况下，响应必须在 HTTP 服务器的写超时之前写出，
+		// 所以我们需要刷新响应。还需要设置 Content-Length 头，
+		// 以确保客户端知道何时收到了完整的响应。
+		encdata, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("content-length", strconv.Itoa(len(encdata)))
+
+		// 如果此请求被可能删除 Content-Length 的处理程序包装，我们需要
+		// 确保 HTTP 服务器不执行分块编码。如果达到了 WriteTimeout，
+		// 分块编码可能无法正确结束，而有些客户端不接受缺少最后一个块。
+		w.Header().Set("transfer-encoding", "identity")
+
+		_, err = w.Write(encdata)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return err
+	}
+
+	dec := json.NewDecoder(conn)
+	dec.UseNumber()
+
+	codec := NewFuncCodec(conn, encoder, dec.Decode)
+	return &httpServerCodec{codec, newHTTPPeerInfo(r, "http")}
+}
+
+// httpServerCodec 是 HTTP 请求的编解码器，它报告 HTTP 对端的信息。
+type httpServerCodec struct {
+	ServerCodec
+	info PeerInfo
+}
+
+func (c *httpServerCodec) peerInfo() PeerInfo {
+	return c.info
+}
+
+// Close 什么也不做，总是返回 nil。
+func (t *httpServerConn) Close() error { return nil }
+
+// RemoteAddr 返回底层连接的对端地址。
+func (t *httpServerConn) RemoteAddr() string {
+	return t.r.RemoteAddr
+}
+
+// SetWriteDeadline 什么也不做，总是返回 nil。
+func (t *httpServerConn) SetWriteDeadline(time.Time) error { return nil }
+
+// ServeHTTP 通过 HTTP 提供 JSON-RPC 请求服务。
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.serveHTTP(w, r, nil)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request, modules moduleSet) {
+	// 客户端接受时压缩较大的响应。
+	w.Header().Add("vary", "accept-encoding")
+	if acceptsGzip(r) {
+		gw := newGzipResponseWriter(w)
+		defer gw.close()
+		w = gw
+	}
+	// 允许用于远程健康检查 (AWS) 的空请求
+	if r.Method == http.MethodGet && r.ContentLength == 0 && r.URL.RawQuery == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if code, err := validateRequest(r); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	// 所有检查都已通过，创建一个编解码器，它直接从请求体读取直到 EOF，
+	// 将响应写入 w，并让服务器处理单个请求。
+	w.Header().Set("content-type", contentType)
+	codec := newHTTPServerConn(r, w)
+	defer codec.close()
+	s.serveSingleRequest(r.Context(), codec, modules)
+}
+
+// validateRequest 如果请求无效，则返回非零的响应码和错误消息。
+func validateRequest(r *http.Request) (int, error) {
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+		return http.StatusMethodNotAllowed, errors.New("method not allowed")
+	}
+	if r.ContentLength > maxRequestContentLength {
+		err := fmt.Errorf("content length too large (%d>%d)", r.ContentLength, maxRequestContentLength)
+		return http.StatusRequestEntityTooLarge, err
+	}
+	// 允许 OPTIONS（无论 content-type 如何）
+	if r.Method == http.MethodOptions {
+		return 0, nil
+	}
+	// 检查 content-type
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("content-type")); err == nil {
+		for _, accepted := range acceptedContentTypes {
+			if accepted == mt {
+				return 0, nil
+			}
+		}
+	}
+	// 无效的 content-type
+	err := fmt.Errorf("invalid content type, only %s is supported", contentType)
+	return http.StatusUnsupportedMediaType, err
+}
@@ -0,0 +1,300 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func confirmStatusCode(t *testing.T, got, want int) {
+	t.Helper()
+	if got == want {
+		return
+	}
+	if gotName := http.StatusText(got); len(gotName) > 0 {
+		if wantName := http.StatusText(want); len(wantName) > 0 {
+			t.Fatalf("response status code: got %d (%s), want %d (%s)", got, gotName, want, wantName)
+		}
+	}
+	t.Fatalf("response status code: got %d, want %d", got, want)
+}
+
+func confirmRequestValidationCode(t *testing.T, method, contentType, body string, expectedStatusCode int) {
+	t.Helper()
+	request := httptest.NewRequest(method, "http://url.com", strings.NewReader(body))
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	code, err := validateRequest(request)
+	if code == 0 {
+		if err != nil {
+			t.Errorf("validation: got error %v, expected nil", err)
+		}
+	} else if err == nil {
+		t.Errorf("validation: code %d: got nil, expected error", code)
+	}
+	confirmStatusCode(t, code, expectedStatusCode)
+}
+
+func TestHTTPErrorResponseWithDelete(t *testing.T) {
+	confirmRequestValidationCode(t, http.MethodDelete, contentType, "", http.StatusMethodNotAllowed)
+}
+
+func TestHTTPErrorResponseWithPut(t *testing.T) {
+	confirmRequestValidationCode(t, http.MethodPut, contentType, "", http.StatusMethodNotAllowed)
+}
+
+func TestHTTPErrorResponseWithMaxContentLength(t *testing.T) {
+	body := make([]rune, maxRequestContentLength+1)
+	confirmRequestValidationCode(t,
+		http.MethodPost, contentType, string(body), http.StatusRequestEntityTooLarge)
+}
+
+func TestHTTPErrorResponseWithEmptyContentType(t *testing.T) {
+	confirmRequestValidationCode(t, http.MethodPost, "", "", http.StatusUnsupportedMediaType)
+}
+
+func TestHTTPErrorResponseWithValidRequest(t *testing.T) {
+	confirmRequestValidationCode(t, http.MethodPost, contentType, "", 0)
+}
+
+func confirmHTTPRequestYieldsStatusCode(t *testing.T, method, contentType, body string, expectedStatusCode int) {
+	t.Helper()
+	s := newTestServer()
+	defer s.Stop()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	request, err := http.NewRequest(method, ts.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create a valid HTTP request: %v", err)
+	}
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	confirmStatusCode(t, resp.StatusCode, expectedStatusCode)
+}
+
+func TestHTTPResponseWithEmptyGet(t *testing.T) {
+	confirmHTTPRequestYieldsStatusCode(t, http.MethodGet, "", "", http.StatusOK)
+}
+
+func TestHTTPResponseWithBadContentType(t *testing.T) {
+	confirmHTTPRequestYieldsStatusCode(t, http.MethodPost, "text/plain", "{}", http.StatusUnsupportedMediaType)
+}
+
+func TestHTTPServeRequest(t *testing.T) {
+	s := newTestServer()
+	defer s.Stop()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{
+			body: `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",3]}`,
+			want: `{"jsonrpc":"2.0","id":1,"result":{"String":"x","Int":3,"Args":null}}`,
+		},
+		{
+			body: `[{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",1]},{"jsonrpc":"2.0","id":2,"method":"test_noArgsRets"}]`,
+			want: `[{"jsonrpc":"2.0","id":1,"result":{"String":"x","Int":1,"Args":null}},{"jsonrpc":"2.0","id":2,"result":null}]`,
+		},
+		{
+			body: `{"jsonrpc":"2.0","id":1,"method":"test_echo"`,
+			want: `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`,
+		},
+	}
+	for i, test := range tests {
+		resp, err := http.Post(ts.URL, contentType, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("test %d: request failed: %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("test %d: can't read body: %v", i, err)
+		}
+		confirmStatusCode(t, resp.StatusCode, http.StatusOK)
+		if ct := resp.Header.Get("content-type"); ct != contentType {
+			t.Errorf("test %d: wrong content-type %q", i, ct)
+		}
+		if got := strings.TrimSpace(string(body)); got != test.want {
+			t.Errorf("test %d: wrong response\ngot:  %s\nwant: %s", i, got, test.want)
+		}
+	}
+}
+
+func TestHTTPErrorResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("error has occurred!"))
+	}))
+	defer ts.Close()
+
+	c, err := DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r string
+	err = c.Call(&r, "test_method")
+	if err == nil {
+		t.Fatal("error was expected")
+	}
+
+	httpErr, ok := err.(HTTPError)
+	if !ok {
+		t.Fatalf("unexpected error type %T", err)
+	}
+
+	if httpErr.StatusCode != http.StatusTeapot {
+		t.Error("unexpected status code", httpErr.StatusCode)
+	}
+	if httpErr.Status != "418 I'm a teapot" {
+		t.Error("unexpected status text", httpErr.Status)
+	}
+	if body := string(httpErr.Body); body != "error has occurred!" {
+		t.Error("unexpected body", body)
+	}
+
+	if errMsg := httpErr.Error(); errMsg != "418 I'm a teapot: error has occurred!" {
+		t.Error("unexpected error message", errMsg)
+	}
+}
+
+func TestHTTPClientCall(t *testing.T) {
+	s := newTestServer()
+	defer s.Stop()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, err := DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var resp echoResult
+	if err := c.Call(&resp, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	want := echoResult{"hello", 10, &echoArgs{"world"}}
+	if resp.String != want.String || resp.Int != want.Int || *resp.Args != *want.Args {
+		t.Errorf("incorrect result %#v", resp)
+	}
+
+	err = c.Call(nil, "test_returnError")
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != 444 {
+		t.Errorf("wrong error %v", err)
+	}
+}
+
+func TestHTTPClientBatchCall(t *testing.T) {
+	s := newTestServer()
+	defer s.Stop()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, err := DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"hello", 10, &echoArgs{"world"}}, Result: new(echoResult)},
+		{Method: "test_echo", Args: []interface{}{"hello2", 11, nil}, Result: new(echoResult)},
+		{Method: "no_such_method", Args: []interface{}{1, 2, 3}, Result: new(int)},
+	}
+	if err := c.BatchCallContext(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if r := batch[0].Result.(*echoResult); batch[0].Error != nil || r.String != "hello" || r.Args.S != "world" {
+		t.Errorf("wrong result for element 0: %#v, err %v", r, batch[0].Error)
+	}
+	if r := batch[1].Result.(*echoResult); batch[1].Error != nil || r.String != "hello2" || r.Args != nil {
+		t.Errorf("wrong result for element 1: %#v, err %v", r, batch[1].Error)
+	}
+	if _, ok := batch[2].Error.(Error); !ok {
+		t.Errorf("expected RPC error for element 2, got %v", batch[2].Error)
+	}
+}
+
+func TestHTTPClientHeaders(t *testing.T) {
+	var gotHeader http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("content-type", contentType)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"ok"}`))
+	}))
+	defer ts.Close()
+
+	c, err := DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetHeader("X-Custom", "foo")
+	c.SetHeader("accept", "application/json-rpc")
+
+	var result string
+	if err := c.Call(&result, "test_method"); err != nil {
+		t.Fatal(err)
+	}
+	if result != "ok" {
+		t.Errorf("wrong result %q", result)
+	}
+	if v := gotHeader.Get("X-Custom"); v != "foo" {
+		t.Errorf("wrong X-Custom header %q", v)
+	}
+	if v := gotHeader.Get("Accept"); v != "application/json-rpc" {
+		t.Errorf("wrong Accept header %q", v)
+	}
+	if v := gotHeader.Get("Content-Type"); v != contentType {
+		t.Errorf("wrong Content-Type header %q", v)
+	}
+}
+
+// 此测试检查 HTTP 服务器的 WriteTimeout 限制方法的执行时间。
+func TestHTTPWriteTimeout(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	timeouts := DefaultHTTPTimeouts
+	timeouts.WriteTimeout = time.Second
+	httpsrv := httptest.NewUnstartedServer(server)
+	httpsrv.Config = NewHTTPServer(server, timeouts)
+	httpsrv.Start()
+	defer httpsrv.Close()
+
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 超时错误必须在 HTTP 服务器断开连接之前到达。
+	checkTimeoutError(t, client.Call(nil, "test_block"))
+
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"x", 1, nil}, Result: new(echoResult)},
+		{Method: "test_block", Result: new(interface{})},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].Error != nil {
+		t.Errorf("unexpected error for first element: %v", batch[0].Error)
+	}
+	checkTimeoutError(t, batch[1].Error)
+}
@@ -0,0 +1,17 @@
+package rpc
+
+import (
+	"context"
+	"net"
+)
+
+// DialInProc 将内存中的连接附加到给定的 RPC 服务器。
+func DialInProc(handler *Server) *Client {
+	initctx := context.Background()
+	c, _ := newClient(initctx, func(context.Context) (ServerCodec, error) {
+		p1, p2 := net.Pipe()
+		go handler.ServeCodec(newTransportCodec(p1, "inproc"), 0)
+		return newTransportCodec(p2, "inproc"), nil
+	})
+	return c
+}
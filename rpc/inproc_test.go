@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestInProcCall(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp echoResult
+	if err := client.Call(&resp, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (echoResult{"hello", 10, &echoArgs{"world"}}); !reflect.DeepEqual(resp, want) {
+		t.Errorf("wrong result %+v, want %+v", resp, want)
+	}
+}
+
+func TestInProcBatch(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"hello", 10, &echoArgs{"world"}}, Result: new(echoResult)},
+		{Method: "no_such_method", Args: []interface{}{1, 2, 3}, Result: new(int)},
+	}
+	if err := client.BatchCallContext(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if want := (&echoResult{"hello", 10, &echoArgs{"world"}}); !reflect.DeepEqual(batch[0].Result, want) {
+		t.Errorf("wrong result %+v, want %+v", batch[0].Result, want)
+	}
+	if batch[0].Error != nil {
+		t.Errorf("unexpected error for first element: %v", batch[0].Error)
+	}
+	if batch[1].Error == nil {
+		t.Error("expected error for unknown method")
+	}
+}
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"flychain/log"
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+// Call 描述一个被拦截器处理的方法调用。
+type Call struct {
+	// Method 是完整的方法名，例如 "eth_getBalance"。对于订阅，
+	// 它是 "<namespace>_subscribe"，订阅名称在 Subscription 中。
+	Method string
+
+	// Subscription 是要创建的订阅的名称。对于普通方法调用为空。
+	Subscription string
+
+	// Args 包含解码后的参数。拦截器可以在调用 next 之前修改参数，
+	// 但每个参数必须可以赋值给方法声明的参数类型。
+	Args []interface{}
+
+	// Peer 描述发出调用的连接。
+	Peer PeerInfo
+}
+
+// CallHandler 执行一个方法调用并返回其结果。
+type CallHandler func(ctx context.Context, call *Call) (interface{}, error)
+
+// Interceptor 包装方法的执行和订阅的创建。拦截器可以调用 next 继续处理调用，
+// 也可以不调用 next 而直接返回错误来拒绝调用。如果错误实现了 Error，
+// 则客户端收到其错误代码。
+type Interceptor func(ctx context.Context, call *Call, next CallHandler) (interface{}, error)
+
+// Use 向服务器添加拦截器。拦截器按添加的顺序运行，第一个添加的拦截器
+// 最先看到调用。
+//
+// 应在服务器开始处理请求之前调用此方法。
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+// intercept 通过处理程序的拦截器链运行回调。拦截器中的 panic 与方法中的
+// panic 一样被捕获，并作为错误返回给客户端。
+func (h *handler) intercept(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			log.Error("RPC interceptor for " + msg.Method + " crashed: " + fmt.Sprintf("%v\n%s", r, buf))
+			result, err = nil, &internalServerError{errcodePanic, "method handler crashed"}
+		}
+	}()
+	call := &Call{Method: msg.Method, Peer: h.peer, Args: make([]interface{}, len(args))}
+	if msg.isSubscribe() {
+		call.Subscription, _ = parseSubscriptionName(msg.Params)
+	}
+	for i, arg := range args {
+		call.Args[i] = arg.Interface()
+	}
+
+	next := func(ctx context.Context, call *Call) (interface{}, error) {
+		args, err := callb.convertArgs(call.Args)
+		if err != nil {
+			return nil, &invalidParamsError{err.Error()}
+		}
+		return callb.call(ctx, msg.Method, args)
+	}
+	for i := len(h.interceptors) - 1; i >= 0; i-- {
+		ic, inner := h.interceptors[i], next
+		next = func(ctx context.Context, call *Call) (interface{}, error) {
+			return ic(ctx, call, inner)
+		}
+	}
+	return next(ctx, call)
+}
+
+// convertArgs 将拦截器传递的参数转换为回调的参数。缺少的参数使用零值。
+func (c *callback) convertArgs(args []interface{}) ([]reflect.Value, error) {
+	if len(args) > len(c.argTypes) {
+		return nil, fmt.Errorf("too many arguments, want at most %d", len(c.argTypes))
+	}
+	values := make([]reflect.Value, len(c.argTypes))
+	for i, typ := range c.argTypes {
+		if i >= len(args) || args[i] == nil {
+			values[i] = reflect.Zero(typ)
+			continue
+		}
+		v := reflect.ValueOf(args[i])
+		if !v.Type().AssignableTo(typ) {
+			return nil, fmt.Errorf("invalid argument %d: cannot use %T as %v", i, args[i], typ)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,193 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterceptorChain(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		trace []string
+		calls []Call
+	)
+	server := newTestServer()
+	server.Use(
+		func(ctx context.Context, call *Call, next CallHandler) (interface{}, error) {
+			mu.Lock()
+			trace = append(trace, "first")
+			c := *call
+			c.Args = append([]interface{}{}, call.Args...)
+			calls = append(calls, c)
+			mu.Unlock()
+			return next(ctx, call)
+		},
+		func(ctx context.Context, call *Call, next CallHandler) (interface{}, error) {
+			mu.Lock()
+			trace = append(trace, "second")
+			mu.Unlock()
+			if call.Method == "test_echo" {
+				call.Args[0] = "rewritten"
+			}
+			return next(ctx, call)
+		},
+	)
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	want := echoResult{"rewritten", 10, &echoArgs{"world"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("wrong result %+v, want %+v", result, want)
+	}
+	if !reflect.DeepEqual(trace, []string{"first", "second"}) {
+		t.Errorf("wrong interceptor order %v", trace)
+	}
+	wantCall := Call{
+		Method: "test_echo",
+		Args:   []interface{}{"hello", 10, &echoArgs{"world"}},
+		Peer:   PeerInfo{Transport: "inproc"},
+	}
+	if len(calls) != 1 || !reflect.DeepEqual(calls[0], wantCall) {
+		t.Errorf("wrong call %+v, want %+v", calls, wantCall)
+	}
+
+	// 缺少的可选参数以 nil 传递给拦截器。
+	if err := client.Call(&result, "test_echo", "hello", 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls[1].Args; len(got) != 3 || got[2] != (*echoArgs)(nil) {
+		t.Errorf("wrong args for call with optional argument: %v", got)
+	}
+}
+
+func TestInterceptorReject(t *testing.T) {
+	server := newTestServer()
+	server.Use(func(ctx context.Context, call *Call, next CallHandler) (interface{}, error) {
+		switch call.Method {
+		case "test_block":
+			return nil, testError{}
+		case "test_repeat":
+			call.Args[1] = "not an int"
+		}
+		return next(ctx, call)
+	})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	// 拦截器返回的错误代码被传递给客户端，方法不会运行。
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var rpcErr Error
+	err := client.CallContext(ctx, nil, "test_block")
+	if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != 444 {
+		t.Fatalf("wrong error %v", err)
+	}
+
+	// 类型错误的参数会导致 invalid params 错误。
+	err = client.Call(nil, "test_repeat", "x", 2)
+	if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != -32602 {
+		t.Fatalf("wrong error for invalid rewritten argument: %v", err)
+	}
+}
+
+// 此测试检查拦截器中的 panic 被作为错误返回，而不会使服务器崩溃。
+func TestInterceptorPanic(t *testing.T) {
+	server := newTestServer()
+	server.Use(func(ctx context.Context, call *Call, next CallHandler) (interface{}, error) {
+		if call.Method == "test_echo" {
+			panic("interceptor failure")
+		}
+		return next(ctx, call)
+	})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var rpcErr Error
+	err := client.Call(nil, "test_echo", "x", 1)
+	if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != errcodePanic || err.Error() != "method handler crashed" {
+		t.Fatalf("wrong error %v", err)
+	}
+	// 服务器仍在运行。
+	if err := client.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInterceptorSubscription(t *testing.T) {
+	calls := make(chan Call, 10)
+	server := newTestServer()
+	server.Use(func(ctx context.Context, call *Call, next CallHandler) (interface{}, error) {
+		calls <- *call
+		if call.Subscription == "hangSubscription" {
+			return nil, errors.New("subscription not allowed")
+		}
+		return next(ctx, call)
+	})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	ch := make(chan int)
+	sub, err := client.Subscribe(context.Background(), "nftest", ch, "someSubscription", 1, 7)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	select {
+	case v := <-ch:
+		if v != 7 {
+			t.Fatalf("wrong value %d", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+	sub.Unsubscribe()
+
+	call := <-calls
+	want := Call{Method: "nftest_subscribe", Subscription: "someSubscription", Args: []interface{}{1, 7}, Peer: PeerInfo{Transport: "inproc"}}
+	if !reflect.DeepEqual(call, want) {
+		t.Errorf("wrong call %+v, want %+v", call, want)
+	}
+	if call := <-calls; call.Method != "nftest_unsubscribe" {
+		t.Errorf("unsubscribe not intercepted, got %+v", call)
+	}
+
+	if _, err := client.Subscribe(context.Background(), "nftest", ch, "hangSubscription", 1); err == nil || err.Error() != "subscription not allowed" {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+func TestInterceptorPeerInfoHTTP(t *testing.T) {
+	peers := make(chan PeerInfo, 1)
+	server := newTestServer()
+	server.Use(func(ctx context.Context, call *Call, next CallHandler) (interface{}, error) {
+		peers <- call.Peer
+		return next(ctx, call)
+	})
+	defer server.Stop()
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatal(err)
+	}
+	if peer := <-peers; peer.Transport != "http" || peer.RemoteAddr == "" {
+		t.Errorf("wrong peer info %+v", peer)
+	}
+}
@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"context"
+	"flychain/log"
+	"net"
+)
+
+// ServeListener 接受 l 上的连接，并在其上提供 JSON-RPC 服务。
+func (s *Server) ServeListener(l net.Listener) error {
+	return s.serveListener(l, nil)
+}
+
+func (s *Server) serveListener(l net.Listener, modules moduleSet) error {
+	transport := listenerTransport(l.Addr().Network())
+	for {
+		conn, err := l.Accept()
+		if isTemporaryError(err) {
+			log.Warn("RPC accept error", "err", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		log.Trace("Accepted RPC connection", "conn", conn.RemoteAddr())
+		go s.serveCodec(newTransportCodec(conn, transport), modules)
+	}
+}
+
+// listenerTransport 返回在网络 network 上接受的连接的传输协议名称。
+// Unix 域套接字连接报告为 "ipc"。
+func listenerTransport(network string) string {
+	if network == "unix" {
+		return "ipc"
+	}
+	return network
+}
+
+// isTemporaryError 报告 Accept 返回的错误是否是暂时性的，可以重试。
+func isTemporaryError(err error) bool {
+	tempErr, ok := err.(interface {
+		Temporary() bool
+	})
+	return ok && tempErr.Temporary()
+}
+
+// DialIPC 创建一个新的 IPC 客户端，它连接到给定的端点。在 Unix 上，
+// 端点是 Unix 域套接字的路径。
+//
+// 上下文用于初始连接的建立。它不影响与客户端的后续交互。
+func DialIPC(ctx context.Context, endpoint string) (*Client, error) {
+	return newClient(ctx, func(ctx context.Context) (ServerCodec, error) {
+		conn, err := newIPCConnection(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return newTransportCodec(conn, "ipc"), err
+	})
+}
+
+// IPCEndpoint 在给定路径上创建 IPC 套接字，并在后台为 s 提供服务。
+// 它返回监听器，关闭监听器即可停止接受新连接。
+func (s *Server) IPCEndpoint(endpoint string) (net.Listener, error) {
+	return s.ipcEndpoint(endpoint, nil)
+}
+
+func (s *Server) ipcEndpoint(endpoint string, modules moduleSet) (net.Listener, error) {
+	listener, err := ipcListen(endpoint)
+	if err != nil {
+		log.Warn("IPC opening failed", "url", endpoint, "error", err)
+		return nil, err
+	}
+	go s.serveListener(listener, modules)
+	return listener, nil
+}
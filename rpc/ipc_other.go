@@ -0,0 +1,22 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+var errIPCNotSupported = errors.New("rpc: IPC transport is not supported on this platform")
+
+// ipcListen 在不支持 Unix 域套接字的平台上总是返回错误。
+func ipcListen(endpoint string) (net.Listener, error) {
+	return nil, errIPCNotSupported
+}
+
+// newIPCConnection 在不支持 Unix 域套接字的平台上总是返回错误。
+func newIPCConnection(ctx context.Context, endpoint string) (net.Conn, error) {
+	return nil, errIPCNotSupported
+}
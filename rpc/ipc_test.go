@@ -0,0 +1,127 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// ipcTestPath 返回一个足够短的套接字路径。t.TempDir 返回的路径可能
+// 超过 sun_path 的长度限制。
+func ipcTestPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "rpc-ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "test.ipc")
+}
+
+func TestIPCCall(t *testing.T) {
+	var (
+		server   = newTestServer()
+		endpoint = ipcTestPath(t)
+	)
+	defer server.Stop()
+
+	listener, err := server.IPCEndpoint(endpoint)
+	if err != nil {
+		t.Fatal("can't listen:", err)
+	}
+	defer listener.Close()
+
+	fi, err := os.Stat(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("wrong socket permissions %v, want %v", perm, os.FileMode(0600))
+	}
+
+	client, err := DialIPC(context.Background(), endpoint)
+	if err != nil {
+		t.Fatal("can't dial:", err)
+	}
+	defer client.Close()
+
+	var resp echoResult
+	if err := client.Call(&resp, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (echoResult{"hello", 10, &echoArgs{"world"}}); !reflect.DeepEqual(resp, want) {
+		t.Errorf("wrong result %+v, want %+v", resp, want)
+	}
+}
+
+func TestIPCPeerInfo(t *testing.T) {
+	var (
+		server   = newTestServer()
+		endpoint = ipcTestPath(t)
+	)
+	if err := server.RegisterName("peer", peerInfoService{}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	listener, err := server.IPCEndpoint(endpoint)
+	if err != nil {
+		t.Fatal("can't listen:", err)
+	}
+	defer listener.Close()
+	client, err := DialIPC(context.Background(), endpoint)
+	if err != nil {
+		t.Fatal("can't dial:", err)
+	}
+	defer client.Close()
+
+	var info PeerInfo
+	if err := client.Call(&info, "peer_get"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Transport != "ipc" {
+		t.Errorf("wrong transport %q, want %q", info.Transport, "ipc")
+	}
+}
+
+// 此测试检查 ipcListen 是否会删除遗留的套接字文件。
+func TestIPCStaleSocket(t *testing.T) {
+	endpoint := ipcTestPath(t)
+
+	// 创建一个不会被删除的套接字文件。
+	stale, err := net.Listen("unix", endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	if _, err := os.Lstat(endpoint); err != nil {
+		t.Fatal("stale socket not present:", err)
+	}
+
+	l, err := ipcListen(endpoint)
+	if err != nil {
+		t.Fatal("listen on stale socket path failed:", err)
+	}
+	l.Close()
+}
+
+// 此测试检查 ipcListen 是否拒绝删除不是套接字的文件。
+func TestIPCRefuseNonSocket(t *testing.T) {
+	endpoint := ipcTestPath(t)
+	if err := os.WriteFile(endpoint, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := ipcListen(endpoint); err == nil {
+		l.Close()
+		t.Fatal("expected error for non-socket file")
+	}
+	if _, err := os.Stat(endpoint); err != nil {
+		t.Fatal("regular file was removed:", err)
+	}
+}
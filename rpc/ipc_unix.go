@@ -0,0 +1,60 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// maxPathSize 是 sockaddr_un.sun_path 的容量（含结尾的 NUL）。
+// 在 Linux 上是 108 字节，在 BSD 系统上是 104 字节，这里取较小者。
+const maxPathSize = 104
+
+// ipcListen 创建一个 Unix 套接字监听器。套接字文件只对所有者可读写，
+// 遗留在该路径上的旧套接字会先被删除。
+func ipcListen(endpoint string) (net.Listener, error) {
+	if len(endpoint) >= maxPathSize {
+		return nil, fmt.Errorf("unix socket path too long (%d >= %d): %s", len(endpoint), maxPathSize, endpoint)
+	}
+	// 确保 IPC 路径存在，并删除之前的残留
+	if err := os.MkdirAll(filepath.Dir(endpoint), 0751); err != nil {
+		return nil, err
+	}
+	if err := removeStaleSocket(endpoint); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(endpoint, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// removeStaleSocket 删除 endpoint 上遗留的套接字文件。
+// 如果该路径上存在的不是套接字，则返回错误而不是删除它。
+func removeStaleSocket(endpoint string) error {
+	fi, err := os.Lstat(endpoint)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("refusing to remove %s: not a unix socket", endpoint)
+	}
+	return os.Remove(endpoint)
+}
+
+// newIPCConnection 连接到给定的 Unix 套接字端点。
+func newIPCConnection(ctx context.Context, endpoint string) (net.Conn, error) {
+	return new(net.Dialer).DialContext(ctx, "unix", endpoint)
+}
@@ -1,9 +1,13 @@
 package rpc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -31,7 +35,7 @@ type subscriptionResult struct {
 type jsonrpcMessage struct {
 	Version string          `json:"jsonrpc,omitempty"`
 	ID      json.RawMessage `json:"id,omitempty"`
-	Method  string          `json:"method, omitempty"`
+	Method  string          `json:"method,omitempty"`
 	Params  json.RawMessage `json:"params,omitempty"`
 	Error   *jsonError      `json:"error,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
@@ -147,13 +151,14 @@ type ConnRemoteAddr interface {
 // jsonCodec 读取 JSON-RPC 消息并将其写入底层连接。它也有
 // 支持解析参数和序列化（结果）对象。
 type jsonCodec struct {
-	remote  string
-	closer  sync.Once        // close closed channel once
-	closeCh chan interface{} // closed on Close
-	decode  decodeFunc       //解码器允许多重传输
-	encMu   sync.Mutex       //保护编码器
-	encode  encodeFunc       // 允许多重传输的编码器
-	conn    deadlineCloser
+	remote    string
+	transport string           // peerInfo 报告的传输协议名称
+	closer    sync.Once        // close closed channel once
+	closeCh   chan interface{} // closed on Close
+	decode    decodeFunc       //解码器允许多重传输
+	encMu     sync.Mutex       //保护编码器
+	encode    encodeFunc       // 允许多重传输的编码器
+	conn      deadlineCloser
 }
 
 type encodeFunc = func(v interface{}, isErrorResponse bool) error
@@ -166,9 +171,9 @@ type decodeFunc = func(v interface{}) error
 func NewFuncCodec(conn deadlineCloser, encode encodeFunc, decode decodeFunc) ServerCodec {
 	codec := &jsonCodec{
 		closeCh: make(chan interface{}),
-		encode: encode,
-		decode: decode,
-		conn: conn,
+		encode:  encode,
+		decode:  decode,
+		conn:    conn,
 	}
 	if ra, ok := conn.(ConnRemoteAddr); ok {
 		codec.remote = ra.RemoteAddr()
@@ -176,7 +181,167 @@ func NewFuncCodec(conn deadlineCloser, encode encodeFunc, decode decodeFunc) Ser
 	return codec
 }
 
+// NewCodec 创建一个基于连接的编解码器，使用 JSON 流读写消息。
+// 如果 conn 实现了 ConnRemoteAddr，日志消息将包含连接的远程地址。
+func NewCodec(conn Conn) ServerCodec {
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	dec.UseNumber()
 
-func (c *jsonCodec) peerInfo() 
+	encode := func(v interface{}, isErrorResponse bool) error {
+		return enc.Encode(v)
+	}
+	return NewFuncCodec(conn, encode, dec.Decode)
+}
+
+// newTransportCodec 与 NewCodec 相同，但编解码器的 PeerInfo 报告给定的传输协议名称。
+func newTransportCodec(conn Conn, transport string) ServerCodec {
+	codec := NewCodec(conn).(*jsonCodec)
+	codec.transport = transport
+	return codec
+}
+
+func (c *jsonCodec) peerInfo() PeerInfo {
+	return PeerInfo{Transport: c.transport, RemoteAddr: c.remote}
+}
+
+func (c *jsonCodec) remoteAddr() string {
+	return c.remote
+}
+
+func (c *jsonCodec) readBatch() (messages []*jsonrpcMessage, batch bool, err error) {
+	// 从输入流中解码下一个 JSON 对象。
+	// 这一步会校验基本的语法等。
+	var rawmsg json.RawMessage
+	if err := c.decode(&rawmsg); err != nil {
+		return nil, false, err
+	}
+	messages, batch = parseMessage(rawmsg)
+	for i, msg := range messages {
+		if msg == nil {
+			// 消息是 JSON 'null'。用零值替换它，
+			// 使它像其他无效消息一样被处理。
+			messages[i] = new(jsonrpcMessage)
+		}
+	}
+	return messages, batch, nil
+}
+
+func (c *jsonCodec) writeJSON(ctx context.Context, v interface{}, isErrorResponse bool) error {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultWriteTimeout)
+	}
+	c.conn.SetWriteDeadline(deadline)
+	return c.encode(v, isErrorResponse)
+}
+
+func (c *jsonCodec) close() {
+	c.closer.Do(func() {
+		close(c.closeCh)
+		c.conn.Close()
+	})
+}
 
-func 
\ No newline at end of file
+// closed 返回一个在调用 close 时关闭的通道。
+func (c *jsonCodec) closed() <-chan interface{} {
+	return c.closeCh
+}
+
+// parseMessage 将原始字节解析为（批量）JSON-RPC 消息。此函数不会返回错误，
+// 因为 raw 已知是有效的 JSON。
+func parseMessage(raw json.RawMessage) ([]*jsonrpcMessage, bool) {
+	if !isBatch(raw) {
+		msgs := []*jsonrpcMessage{{}}
+		json.Unmarshal(raw, &msgs[0])
+		return msgs, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.Token() // skip '['
+	var msgs []*jsonrpcMessage
+	for dec.More() {
+		msgs = append(msgs, new(jsonrpcMessage))
+		dec.Decode(&msgs[len(msgs)-1])
+	}
+	return msgs, true
+}
+
+// isBatch 当第一个非空白字符是 '[' 时返回 true
+func isBatch(raw json.RawMessage) bool {
+	for _, c := range raw {
+		// 跳过无意义的空白 (http://www.ietf.org/rfc/rfc4627.txt)
+		if c == 0x20 || c == 0x09 || c == 0x0a || c == 0x0d {
+			continue
+		}
+		return c == '['
+	}
+	return false
+}
+
+// parsePositionalArguments 尝试将给定的参数解析为给定类型的 JSON 数组。
+// 返回与类型顺序对应的解析值，或解析失败时的错误。
+// 缺失的可选参数以 reflect.Zero 值返回。
+func parsePositionalArguments(rawArgs json.RawMessage, types []reflect.Type) ([]reflect.Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(rawArgs))
+	var args []reflect.Value
+	tok, err := dec.Token()
+	switch {
+	case err == io.EOF || tok == nil && err == nil:
+		// "params" 是可选的，可以为空。也允许 "params":null，
+		// 尽管规范中没有，因为我们自己的客户端曾经这样发送。
+	case err != nil:
+		return nil, err
+	case tok == json.Delim('['):
+		// 读取参数数组。
+		if args, err = parseArgumentArray(dec, types); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("non-array args")
+	}
+	// 将缺失的参数设置为 nil。
+	for i := len(args); i < len(types); i++ {
+		if types[i].Kind() != reflect.Ptr {
+			return nil, fmt.Errorf("missing value for required argument %d", i)
+		}
+		args = append(args, reflect.Zero(types[i]))
+	}
+	return args, nil
+}
+
+func parseArgumentArray(dec *json.Decoder, types []reflect.Type) ([]reflect.Value, error) {
+	args := make([]reflect.Value, 0, len(types))
+	for i := 0; dec.More(); i++ {
+		if i >= len(types) {
+			return args, fmt.Errorf("too many arguments, want at most %d", len(types))
+		}
+		argval := reflect.New(types[i])
+		if err := dec.Decode(argval.Interface()); err != nil {
+			return args, fmt.Errorf("invalid argument %d: %v", i, err)
+		}
+		if argval.IsNil() && types[i].Kind() != reflect.Ptr {
+			return args, fmt.Errorf("missing value for required argument %d", i)
+		}
+		args = append(args, argval.Elem())
+	}
+	// 读取参数数组的结尾。
+	_, err := dec.Token()
+	return args, err
+}
+
+// parseSubscriptionName 从参数数组中提取订阅名称。
+func parseSubscriptionName(rawArgs json.RawMessage) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(rawArgs))
+	if tok, _ := dec.Token(); tok != json.Delim('[') {
+		return "", errors.New("non-array args")
+	}
+	v, _ := dec.Token()
+	method, ok := v.(string)
+	if !ok {
+		return "", errors.New("expected subscription name as first argument")
+	}
+	return method, nil
+}
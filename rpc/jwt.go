@@ -0,0 +1,221 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	jwtSecretLength = 32               // JWT 密钥的字节长度
+	jwtIatSkew      = 60 * time.Second // iat 声明与本地时间之间允许的最大偏差
+)
+
+var (
+	errMissingToken   = errors.New("missing token")
+	errInvalidToken   = errors.New("invalid token")
+	errBadSignature   = errors.New("signature is invalid")
+	errMissingIat     = errors.New("missing issued-at")
+	errStaleToken     = errors.New("stale token")
+	errFutureToken    = errors.New("future token")
+	errTokenExpired   = errors.New("token is expired")
+	errUnsupportedAlg = errors.New("unsupported signing method")
+)
+
+// jwtHS256Header 是所有由本包签发的令牌使用的头部。
+var jwtHS256Header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// jwtClaims 是本包检查的 JWT 声明。
+type jwtClaims struct {
+	IssuedAt  *int64 `json:"iat,omitempty"`
+	ExpiresAt *int64 `json:"exp,omitempty"`
+	ID        string `json:"id,omitempty"`
+}
+
+// ObtainJWTSecret 从给定文件中读取十六进制编码的 JWT 密钥。
+// 文件内容可以带有 "0x" 前缀，首尾的空白会被忽略。
+func ObtainJWTSecret(fileName string) ([]byte, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(string(data))
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "0x"), "0X")
+	secret, err := hex.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT secret in %s: %v", fileName, err)
+	}
+	if len(secret) != jwtSecretLength {
+		return nil, fmt.Errorf("invalid JWT secret length in %s: have %d bytes, want %d", fileName, len(secret), jwtSecretLength)
+	}
+	return secret, nil
+}
+
+// jwtHandler 是一个 http.Handler，它在把请求交给下一个处理程序之前
+// 验证请求中的 HS256 JWT 令牌。
+type jwtHandler struct {
+	secret []byte
+	next   http.Handler
+}
+
+// NewJWTHandler 创建一个 http.Handler，它只允许携带有效 JWT 令牌的请求
+// 到达 next。令牌必须使用 HS256 和给定的密钥签名，并且 iat 声明与
+// 本地时间的偏差不能超过 60 秒。
+//
+// 此处理程序可以包装 Server 本身（HTTP）以及 Server.WebsocketHandler（WebSocket）。
+// 对于 WebSocket，令牌在握手请求中检查。
+//
+// 令牌的 id 声明（没有时为 "jwt"）作为调用者的身份出现在 PeerInfo.Identity 中。
+// 如果密钥不是 32 字节，则返回错误。
+func NewJWTHandler(secret []byte, next http.Handler) (http.Handler, error) {
+	if err := checkJWTSecret(secret); err != nil {
+		return nil, err
+	}
+	return &jwtHandler{secret: append([]byte(nil), secret...), next: next}, nil
+}
+
+// ServeHTTP 实现 http.Handler。
+func (handler *jwtHandler) ServeHTTP(out http.ResponseWriter, r *http.Request) {
+	var token string
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if len(token) == 0 {
+		http.Error(out, errMissingToken.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := verifyJWT(token, handler.secret, time.Now()); err != nil {
+		http.Error(out, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	ctx := WithAuthIdentity(r.Context(), jwtIdentity(token))
+	handler.next.ServeHTTP(out, r.WithContext(ctx))
+}
+
+// jwtIdentity 返回已验证令牌的调用者身份：令牌的 id 声明，
+// 如果没有该声明则为 "jwt"。
+func jwtIdentity(token string) string {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if decodeJWTSegment(parts[1], &claims) == nil && claims.ID != "" {
+		return claims.ID
+	}
+	return "jwt"
+}
+
+// verifyJWT 检查令牌的签名以及 iat 和 exp 声明。
+func verifyJWT(token string, secret []byte, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return errInvalidToken
+	}
+	if header.Alg != "HS256" {
+		return errUnsupportedAlg
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errInvalidToken
+	}
+	if !hmac.Equal(sig, signJWT(parts[0]+"."+parts[1], secret)) {
+		return errBadSignature
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return errInvalidToken
+	}
+	if claims.ExpiresAt != nil && now.Unix() >= *claims.ExpiresAt {
+		return errTokenExpired
+	}
+	if claims.IssuedAt == nil {
+		return errMissingIat
+	}
+	// 我们允许 +-60 秒的偏差。
+	iat := time.Unix(*claims.IssuedAt, 0)
+	if diff := now.Sub(iat); diff > jwtIatSkew {
+		return errStaleToken
+	} else if diff < -jwtIatSkew {
+		return errFutureToken
+	}
+	return nil
+}
+
+func decodeJWTSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func signJWT(signingInput string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// newJWTToken 创建一个在给定时间签发、使用 HS256 签名的令牌。
+func newJWTToken(secret []byte, iat time.Time) string {
+	claims, _ := json.Marshal(map[string]int64{"iat": iat.Unix()})
+	signingInput := jwtHS256Header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signJWT(signingInput, secret))
+}
+
+// NewJWTAuth 创建一个 HTTPAuth，它为每个请求签发新的 JWT 令牌，
+// 并将其放入 Authorization 头中。密钥必须是 32 字节，例如 ObtainJWTSecret
+// 读取的密钥。
+func NewJWTAuth(secret []byte) (HTTPAuth, error) {
+	if err := checkJWTSecret(secret); err != nil {
+		return nil, err
+	}
+	secret = append([]byte(nil), secret...)
+	return func(h http.Header) error {
+		h.Set("Authorization", "Bearer "+newJWTToken(secret, time.Now()))
+		return nil
+	}, nil
+}
+
+// checkJWTSecret 检查 JWT 密钥的长度。
+func checkJWTSecret(secret []byte) error {
+	if len(secret) != jwtSecretLength {
+		return fmt.Errorf("invalid JWT secret length: have %d bytes, want %d", len(secret), jwtSecretLength)
+	}
+	return nil
+}
+
+// RegisterAPIs 在服务器上注册给定的 API。需要身份验证的 API
+// （Authenticated 为 true，或者位于 EngineApi 命名空间中）只会在
+// authenticated 为 true 时注册。
+//
+// 此方法本身不检查令牌。authenticated 为 true 的服务器只能通过 NewJWTHandler
+// 包装的处理程序提供服务，不需要身份验证的端点必须使用另一个以
+// authenticated 为 false 注册的服务器。
+func (s *Server) RegisterAPIs(apis []API, authenticated bool) error {
+	for _, api := range apis {
+		if isAuthenticatedAPI(api) && !authenticated {
+			continue
+		}
+		if err := s.RegisterName(api.Namespace, api.Service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isAuthenticatedAPI(api API) bool {
+	return api.Authenticated || api.Namespace == EngineApi
+}
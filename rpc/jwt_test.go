@@ -0,0 +1,205 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testJWTSecret = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32}
+
+func newTestJWTAuth(t *testing.T, secret []byte) HTTPAuth {
+	t.Helper()
+	auth, err := NewJWTAuth(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func newTestJWTHandler(t *testing.T, next http.Handler) http.Handler {
+	t.Helper()
+	handler, err := NewJWTHandler(testJWTSecret, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+type engineTestService struct{}
+
+func (engineTestService) Ping() string { return "pong" }
+
+func TestVerifyJWT(t *testing.T) {
+	var (
+		secret = testJWTSecret
+		now    = time.Now()
+		sign   = func(header, claims string) string {
+			input := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+			return input + "." + base64.RawURLEncoding.EncodeToString(signJWT(input, secret))
+		}
+		hs256 = `{"alg":"HS256","typ":"JWT"}`
+		iat   = func(t time.Time) string { return `{"iat":` + strconv.FormatInt(t.Unix(), 10) + `}` }
+	)
+	tests := []struct {
+		token string
+		want  error
+	}{
+		{newJWTToken(secret, now), nil},
+		{newJWTToken(secret, now.Add(-50*time.Second)), nil},
+		{newJWTToken(secret, now.Add(50*time.Second)), nil},
+		{newJWTToken(secret, now.Add(-61*time.Second)), errStaleToken},
+		{newJWTToken(secret, now.Add(61*time.Second)), errFutureToken},
+		{newJWTToken([]byte("wrong secret"), now), errBadSignature},
+		{sign(hs256, `{}`), errMissingIat},
+		{sign(hs256, `{"iat":`+strconv.FormatInt(now.Unix(), 10)+`,"exp":`+strconv.FormatInt(now.Unix()-1, 10)+`}`), errTokenExpired},
+		{sign(`{"alg":"none"}`, iat(now)), errUnsupportedAlg},
+		{sign(`{"alg":"HS512"}`, iat(now)), errUnsupportedAlg},
+		{"a.b", errInvalidToken},
+		{"not.a.token", errInvalidToken},
+	}
+	for i, test := range tests {
+		if err := verifyJWT(test.token, secret, now); err != test.want {
+			t.Errorf("test %d: wrong error %v, want %v", i, err, test.want)
+		}
+	}
+}
+
+func TestObtainJWTSecret(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	const hexSecret = "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
+
+	for _, content := range []string{hexSecret, "0x" + hexSecret, " 0x" + hexSecret + "\n"} {
+		secret, err := ObtainJWTSecret(write("ok", content))
+		if err != nil {
+			t.Fatalf("content %q: %v", content, err)
+		}
+		if string(secret) != string(testJWTSecret) {
+			t.Fatalf("content %q: wrong secret %x", content, secret)
+		}
+		if _, err := NewJWTAuth(secret); err != nil {
+			t.Fatalf("content %q: can't use secret: %v", content, err)
+		}
+	}
+	for _, content := range []string{"", "0x1234", "zz" + hexSecret[2:]} {
+		if _, err := ObtainJWTSecret(write("bad", content)); err == nil {
+			t.Errorf("content %q: expected error", content)
+		}
+	}
+	if _, err := ObtainJWTSecret(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestJWTSecretLength(t *testing.T) {
+	for _, n := range []int{0, 16, jwtSecretLength + 1} {
+		if _, err := NewJWTAuth(make([]byte, n)); err == nil {
+			t.Errorf("NewJWTAuth: no error for %d byte secret", n)
+		}
+		if _, err := NewJWTHandler(make([]byte, n), http.NotFoundHandler()); err == nil {
+			t.Errorf("NewJWTHandler: no error for %d byte secret", n)
+		}
+	}
+	if _, err := NewJWTHandler(nil, http.NotFoundHandler()); err == nil {
+		t.Error("NewJWTHandler: no error for nil secret")
+	}
+	if _, err := NewHTTPHandlerStack(http.NotFoundHandler(), nil, nil, make([]byte, 16)); err == nil {
+		t.Error("NewHTTPHandlerStack: no error for short secret")
+	}
+}
+
+// 此测试检查需要身份验证的命名空间只在受保护的端点上可用。
+func TestJWTAuthHTTP(t *testing.T) {
+	apis := []API{
+		{Namespace: "test", Service: new(testService)},
+		{Namespace: EngineApi, Service: new(engineTestService)},
+	}
+	open := NewServer()
+	if err := open.RegisterAPIs(apis, false); err != nil {
+		t.Fatal(err)
+	}
+	defer open.Stop()
+	auth := NewServer()
+	if err := auth.RegisterAPIs(apis, true); err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Stop()
+
+	openSrv := httptest.NewServer(open)
+	defer openSrv.Close()
+	authSrv := httptest.NewServer(newTestJWTHandler(t, auth))
+	defer authSrv.Close()
+
+	// 未受保护的端点不提供 engine 命名空间。
+	client, _ := DialHTTP(openSrv.URL)
+	var result string
+	if err := client.Call(&result, "engine_ping"); err == nil {
+		t.Fatal("engine namespace available on unauthenticated endpoint")
+	}
+	if err := client.Call(&result, "test_repeat", "a", 2); err != nil || result != "aa" {
+		t.Fatalf("unexpected result %q, err %v", result, err)
+	}
+
+	// 没有令牌的请求被拒绝。
+	client, _ = DialHTTP(authSrv.URL)
+	err := client.Call(&result, "engine_ping")
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong error for missing token: %v", err)
+	}
+
+	// 错误密钥签发的令牌被拒绝。
+	client, _ = DialHTTPWithAuth(authSrv.URL, newTestJWTAuth(t, make([]byte, jwtSecretLength)))
+	if err := client.Call(&result, "engine_ping"); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong error for bad token: %v", err)
+	}
+
+	// 有效的令牌。
+	client, _ = DialHTTPWithAuth(authSrv.URL, newTestJWTAuth(t, testJWTSecret))
+	for i := 0; i < 2; i++ {
+		if err := client.Call(&result, "engine_ping"); err != nil || result != "pong" {
+			t.Fatalf("call %d: unexpected result %q, err %v", i, result, err)
+		}
+	}
+}
+
+func TestJWTAuthWebsocket(t *testing.T) {
+	srv := NewServer()
+	if err := srv.RegisterAPIs([]API{{Namespace: EngineApi, Service: new(engineTestService)}}, true); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	httpsrv := httptest.NewServer(newTestJWTHandler(t, srv.WebsocketHandler([]string{"*"})))
+	defer httpsrv.Close()
+	wsURL := "ws:" + strings.TrimPrefix(httpsrv.URL, "http:")
+
+	if client, err := DialWebsocket(context.Background(), wsURL, ""); err == nil {
+		client.Close()
+		t.Fatal("no error for websocket dial without token")
+	}
+
+	client, err := DialWebsocketWithAuth(context.Background(), wsURL, "", newTestJWTAuth(t, testJWTSecret))
+	if err != nil {
+		t.Fatal("can't dial with token:", err)
+	}
+	defer client.Close()
+	var result string
+	if err := client.Call(&result, "engine_ping"); err != nil || result != "pong" {
+		t.Fatalf("unexpected result %q, err %v", result, err)
+	}
+}
@@ -0,0 +1,140 @@
+package rpc
+
+import (
+	"flychain/common/mclock"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits 配置服务器对方法调用的限制。零值表示不做任何限制。
+type Limits struct {
+	// MaxConcurrentPerConn 是单个连接上同时执行的请求数上限。
+	// 批处理请求算作一个请求。
+	MaxConcurrentPerConn int
+
+	// MaxInFlight 是整个服务器上同时执行的请求数上限。
+	MaxInFlight int
+
+	// Rates 为方法或命名空间设置令牌桶速率限制。键可以是完整的
+	// 方法名（"eth_call"），也可以是命名空间（"eth"）。如果两者都存在，
+	// 则使用方法的限制。
+	Rates map[string]Rate
+}
+
+// Rate 描述一个令牌桶：令牌以每秒 PerSecond 个的速度补充，
+// 桶中最多保存 Burst 个令牌。
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// SetLimits 设置服务器的调用限制。新的限制立即对所有连接生效。
+func (s *Server) SetLimits(limits Limits) {
+	s.limiter.setLimits(limits)
+}
+
+// callLimiter 实现服务器的调用限制。它被服务器的所有连接共享。
+type callLimiter struct {
+	clock    mclock.Clock
+	inflight int64 // 所有连接上正在执行的请求数
+
+	mu      sync.RWMutex
+	limits  Limits
+	buckets map[string]*tokenBucket
+}
+
+func newCallLimiter(clock mclock.Clock) *callLimiter {
+	return &callLimiter{clock: clock}
+}
+
+func (l *callLimiter) setLimits(limits Limits) {
+	buckets := make(map[string]*tokenBucket, len(limits.Rates))
+	for key, rate := range limits.Rates {
+		buckets[key] = newTokenBucket(rate, l.clock.Now())
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	l.buckets = buckets
+}
+
+// acquire 为 h 上的一个新请求占用执行槽。如果达到了连接或服务器的并发上限，
+// 则返回错误，此时不占用任何槽。
+func (l *callLimiter) acquire(h *handler) error {
+	l.mu.RLock()
+	perConn, global := l.limits.MaxConcurrentPerConn, l.limits.MaxInFlight
+	l.mu.RUnlock()
+
+	if n := atomic.AddInt32(&h.activeCalls, 1); perConn > 0 && int(n) > perConn {
+		atomic.AddInt32(&h.activeCalls, -1)
+		return &limitExceededError{"too many concurrent requests on connection"}
+	}
+	if n := atomic.AddInt64(&l.inflight, 1); global > 0 && int(n) > global {
+		atomic.AddInt64(&l.inflight, -1)
+		atomic.AddInt32(&h.activeCalls, -1)
+		return &limitExceededError{"too many concurrent requests"}
+	}
+	return nil
+}
+
+// release 释放 acquire 占用的执行槽。
+func (l *callLimiter) release(h *handler) {
+	atomic.AddInt32(&h.activeCalls, -1)
+	atomic.AddInt64(&l.inflight, -1)
+}
+
+// allow 检查给定方法的速率限制。
+func (l *callLimiter) allow(method string) error {
+	l.mu.RLock()
+	bucket := l.buckets[method]
+	if bucket == nil {
+		if i := strings.Index(method, serviceMethodSeparator); i > 0 {
+			bucket = l.buckets[method[:i]]
+		}
+	}
+	l.mu.RUnlock()
+
+	if bucket != nil && !bucket.take(l.clock.Now()) {
+		return &limitExceededError{fmt.Sprintf("rate limit exceeded for %s", method)}
+	}
+	return nil
+}
+
+// tokenBucket 是一个简单的令牌桶速率限制器。
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒补充的令牌数
+	burst  float64
+	tokens float64
+	last   mclock.AbsTime
+}
+
+func newTokenBucket(rate Rate, now mclock.AbsTime) *tokenBucket {
+	burst := float64(rate.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate.PerSecond, burst: burst, tokens: burst, last: now}
+}
+
+// take 在桶中有令牌时取出一个并返回 true。
+func (b *tokenBucket) take(now mclock.AbsTime) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += b.rate * float64(elapsed) / float64(time.Second)
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,230 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"flychain/common/mclock"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// gateService 的 Wait 方法一直阻塞，直到 release 被关闭。
+type gateService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGateService() *gateService {
+	return &gateService{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (s *gateService) Wait(ctx context.Context) {
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+	}
+}
+
+func newLimitTestServer(t *testing.T, limits Limits) (*Server, *gateService) {
+	server := newTestServer()
+	gate := newGateService()
+	if err := server.RegisterName("gate", gate); err != nil {
+		t.Fatal(err)
+	}
+	server.SetLimits(limits)
+	t.Cleanup(func() {
+		close(gate.release)
+		server.Stop()
+	})
+	return server, gate
+}
+
+func waitStarted(t *testing.T, gate *gateService) {
+	select {
+	case <-gate.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not start")
+	}
+}
+
+func checkLimitError(t *testing.T, err error) {
+	t.Helper()
+	rpcErr, ok := err.(Error)
+	if !ok {
+		t.Fatalf("expected rpc.Error, got %v", err)
+	}
+	if rpcErr.ErrorCode() != errcodeLimitExceeded {
+		t.Fatalf("wrong error code %d, want %d (%v)", rpcErr.ErrorCode(), errcodeLimitExceeded, err)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	var clock mclock.Simulated
+	b := newTokenBucket(Rate{PerSecond: 2, Burst: 3}, clock.Now())
+
+	for i := 0; i < 3; i++ {
+		if !b.take(clock.Now()) {
+			t.Fatalf("take %d failed within burst", i)
+		}
+	}
+	if b.take(clock.Now()) {
+		t.Fatal("take succeeded with empty bucket")
+	}
+	clock.Run(500 * time.Millisecond)
+	if !b.take(clock.Now()) {
+		t.Fatal("bucket not refilled after 500ms")
+	}
+	if b.take(clock.Now()) {
+		t.Fatal("bucket refilled too fast")
+	}
+	// 补充的令牌不能超过 burst。
+	clock.Run(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !b.take(clock.Now()) {
+			t.Fatalf("take %d failed after refill", i)
+		}
+	}
+	if b.take(clock.Now()) {
+		t.Fatal("bucket holds more than burst")
+	}
+}
+
+func TestLimitConcurrentPerConn(t *testing.T) {
+	server, gate := newLimitTestServer(t, Limits{MaxConcurrentPerConn: 1})
+	client := DialInProc(server)
+	defer client.Close()
+
+	go client.Call(nil, "gate_wait")
+	waitStarted(t, gate)
+
+	// 同一连接上的第二个调用被拒绝。
+	err := client.Call(nil, "test_echo", "x", 1, nil)
+	checkLimitError(t, err)
+
+	// 批处理中的所有调用都得到错误响应。
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"x", 1, nil}, Result: new(echoResult)},
+		{Method: "test_echo", Args: []interface{}{"y", 2, nil}, Result: new(echoResult)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range batch {
+		checkLimitError(t, elem.Error)
+	}
+
+	// 其他连接不受影响。
+	other := DialInProc(server)
+	defer other.Close()
+	if err := other.Call(nil, "test_echo", "x", 1, nil); err != nil {
+		t.Fatal("call on other connection failed:", err)
+	}
+}
+
+// 此测试检查被拒绝的调用的响应不会阻塞读取循环，即使对端不读取响应。
+func TestLimitRejectSlowReader(t *testing.T) {
+	server, gate := newLimitTestServer(t, Limits{MaxConcurrentPerConn: 1})
+	p1, p2 := net.Pipe()
+	defer p2.Close()
+	go server.ServeCodec(NewCodec(p1), 0)
+
+	if _, err := p2.Write([]byte(`{"jsonrpc":"2.0","id":0,"method":"gate_wait"}`)); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, gate)
+
+	// 在不读取响应的情况下发送被拒绝的调用。net.Pipe 没有缓冲，
+	// 所以只有服务器继续读取时写入才能完成。
+	const n = 5
+	written := make(chan error, 1)
+	go func() {
+		for i := 1; i <= n; i++ {
+			msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"test_echo","params":["x",1]}`, i)
+			if _, err := p2.Write([]byte(msg)); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server stopped reading while rejecting calls")
+	}
+
+	// 所有被拒绝的调用最终都得到错误响应。
+	p2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	dec := json.NewDecoder(p2)
+	for i := 0; i < n; i++ {
+		var resp jsonrpcMessage
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error == nil || resp.Error.Code != errcodeLimitExceeded {
+			t.Fatalf("wrong response %v", &resp)
+		}
+	}
+}
+
+func TestLimitInFlight(t *testing.T) {
+	server, gate := newLimitTestServer(t, Limits{MaxInFlight: 2})
+	c1, c2, c3 := DialInProc(server), DialInProc(server), DialInProc(server)
+	defer c1.Close()
+	defer c2.Close()
+	defer c3.Close()
+
+	go c1.Call(nil, "gate_wait")
+	go c2.Call(nil, "gate_wait")
+	waitStarted(t, gate)
+	waitStarted(t, gate)
+
+	checkLimitError(t, c3.Call(nil, "test_echo", "x", 1, nil))
+
+	// 在限制放宽后，调用可以再次执行。
+	server.SetLimits(Limits{MaxInFlight: 3})
+	if err := c3.Call(nil, "test_echo", "x", 1, nil); err != nil {
+		t.Fatal("call failed after raising limit:", err)
+	}
+}
+
+func TestLimitRates(t *testing.T) {
+	server, _ := newLimitTestServer(t, Limits{
+		Rates: map[string]Rate{
+			"test":        {Burst: 2},
+			"test_repeat": {Burst: 4},
+		},
+	})
+	client := DialInProc(server)
+	defer client.Close()
+
+	// 命名空间限制：允许两次调用，之后被拒绝。
+	for i := 0; i < 2; i++ {
+		if err := client.Call(nil, "test_echo", "x", 1, nil); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	checkLimitError(t, client.Call(nil, "test_echo", "x", 1, nil))
+	checkLimitError(t, client.Call(nil, "test_noArgsRets"))
+
+	// 方法限制优先于命名空间限制。
+	for i := 0; i < 4; i++ {
+		if err := client.Call(nil, "test_repeat", "x", 1); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	checkLimitError(t, client.Call(nil, "test_repeat", "x", 1))
+
+	// 没有限制的命名空间不受影响。
+	for i := 0; i < 5; i++ {
+		if err := client.Call(nil, "nftest_echo", 1); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package rpc
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// latencyBuckets 是调用延迟直方图的上界，单位为秒。
+	latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// batchSizeBuckets 是批处理大小直方图的上界。
+	batchSizeBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+)
+
+const (
+	// metricsContentType 是 Prometheus 文本格式的内容类型。
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// unknownMethodLabel 是无法归属到已注册命名空间的调用使用的方法标签。
+	unknownMethodLabel = "unknown"
+)
+
+// MetricsHandler 返回一个以 Prometheus 文本格式导出服务器调用统计信息的 HTTP 处理程序。
+//
+// 导出的指标包括每个方法的调用次数、成功和失败次数及延迟直方图，
+// 每个命名空间的活跃订阅数，以及批处理大小的分布。只统计已注册的方法，
+// 调用不存在的方法不会产生新的标签，未注册的命名空间的取消订阅调用统计在
+// method="unknown" 标签下。
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", metricsContentType)
+		bw := bufio.NewWriter(w)
+		s.metrics.writeTo(bw)
+		bw.Flush()
+	})
+}
+
+// serverMetrics 收集服务器所有连接的调用统计信息。
+type serverMetrics struct {
+	mu            sync.Mutex
+	methods       map[string]*methodMetrics
+	subscriptions map[string]int64 // 每个命名空间的活跃订阅数
+	batchSizes    *histogram
+}
+
+// methodMetrics 是单个方法的统计信息。
+type methodMetrics struct {
+	success uint64
+	failure uint64
+	latency *histogram
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		methods:       make(map[string]*methodMetrics),
+		subscriptions: make(map[string]int64),
+		batchSizes:    newHistogram(batchSizeBuckets),
+	}
+}
+
+// observeCall 记录一次调用的结果和执行时间。m 为 nil 时什么也不做。
+func (m *serverMetrics) observeCall(method string, success bool, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mm := m.methods[method]
+	if mm == nil {
+		mm = &methodMetrics{latency: newHistogram(latencyBuckets)}
+		m.methods[method] = mm
+	}
+	if success {
+		mm.success++
+	} else {
+		mm.failure++
+	}
+	mm.latency.observe(duration.Seconds())
+}
+
+// observeBatch 记录批处理的大小。
+func (m *serverMetrics) observeBatch(size int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batchSizes.observe(float64(size))
+}
+
+// addSubscriptions 调整命名空间的活跃订阅数。
+func (m *serverMetrics) addSubscriptions(namespace string, delta int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[namespace] += delta
+}
+
+// writeTo 以 Prometheus 文本格式写出所有指标。
+func (m *serverMetrics) writeTo(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	methods := sortedKeys(m.methods)
+	writeHeader(w, "rpc_requests_total", "counter", "Total number of served RPC calls.")
+	for _, name := range methods {
+		mm := m.methods[name]
+		writeSample(w, "rpc_requests_total", methodLabel(name), float64(mm.success+mm.failure))
+	}
+	writeHeader(w, "rpc_requests_success_total", "counter", "Number of RPC calls that returned a result.")
+	for _, name := range methods {
+		writeSample(w, "rpc_requests_success_total", methodLabel(name), float64(m.methods[name].success))
+	}
+	writeHeader(w, "rpc_requests_failure_total", "counter", "Number of RPC calls that returned an error.")
+	for _, name := range methods {
+		writeSample(w, "rpc_requests_failure_total", methodLabel(name), float64(m.methods[name].failure))
+	}
+	writeHeader(w, "rpc_duration_seconds", "histogram", "Execution time of RPC calls.")
+	for _, name := range methods {
+		m.methods[name].latency.writeTo(w, "rpc_duration_seconds", methodLabel(name))
+	}
+	writeHeader(w, "rpc_subscriptions_active", "gauge", "Number of active subscriptions.")
+	for _, namespace := range sortedKeys(m.subscriptions) {
+		writeSample(w, "rpc_subscriptions_active", label("namespace", namespace), float64(m.subscriptions[namespace]))
+	}
+	writeHeader(w, "rpc_batch_size", "histogram", "Number of messages in batch requests.")
+	m.batchSizes.writeTo(w, "rpc_batch_size", "")
+}
+
+// histogram 是具有固定上界的累积直方图。
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] 是不大于 bounds[i] 的观测值的个数（不累积）
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+}
+
+func (h *histogram) writeTo(w *bufio.Writer, name, labels string) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		writeSample(w, name+"_bucket", joinLabels(labels, label("le", formatFloat(bound))), float64(cumulative))
+	}
+	writeSample(w, name+"_bucket", joinLabels(labels, label("le", "+Inf")), float64(h.count))
+	writeSample(w, name+"_sum", labels, h.sum)
+	writeSample(w, name+"_count", labels, float64(h.count))
+}
+
+func writeHeader(w *bufio.Writer, name, typ, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func methodLabel(method string) string {
+	return label("method", method)
+}
+
+// label 返回一个标签对，标签值按照文本格式的要求转义。
+func label(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return name + `="` + value + `"`
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1, 3, 7, 20} {
+		h.observe(v)
+	}
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	h.writeTo(w, "test", `a="b"`)
+	w.Flush()
+
+	want := `test_bucket{a="b",le="1"} 2
+test_bucket{a="b",le="5"} 3
+test_bucket{a="b",le="10"} 4
+test_bucket{a="b",le="+Inf"} 5
+test_sum{a="b"} 31.5
+test_count{a="b"} 5
+`
+	if sb.String() != want {
+		t.Errorf("wrong output:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := client.Call(nil, "test_echo", "x", i, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Call(nil, "test_returnError"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := client.Call(nil, "test_noSuchMethod"); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, method := range []string{"bogus1_unsubscribe", "bogus2_unsubscribe"} {
+		if err := client.Call(nil, method, "0x1"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	batch := []BatchElem{{Method: "test_noArgsRets"}, {Method: "test_noArgsRets"}}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.Subscribe(context.Background(), "nftest", make(chan int), "someSubscription", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	output := scrapeMetrics(t, server)
+	for _, line := range []string{
+		"# TYPE rpc_requests_total counter",
+		`rpc_requests_total{method="test_echo"} 3`,
+		`rpc_requests_success_total{method="test_echo"} 3`,
+		`rpc_requests_failure_total{method="test_echo"} 0`,
+		`rpc_requests_failure_total{method="test_returnError"} 1`,
+		`rpc_requests_total{method="test_noArgsRets"} 2`,
+		`rpc_duration_seconds_count{method="test_echo"} 3`,
+		`rpc_duration_seconds_bucket{method="test_echo",le="+Inf"} 3`,
+		`rpc_requests_total{method="nftest_subscribe"} 1`,
+		`rpc_requests_failure_total{method="unknown"} 2`,
+		`rpc_subscriptions_active{namespace="nftest"} 1`,
+		`rpc_batch_size_bucket{le="2"} 1`,
+		"rpc_batch_size_count 1",
+	} {
+		if !containsLine(output, line) {
+			t.Errorf("missing line %q in output:\n%s", line, output)
+		}
+	}
+	// 不存在的方法不会产生标签。
+	if strings.Contains(output, "test_noSuchMethod") {
+		t.Error("unknown method included in metrics")
+	}
+	// 未注册的命名空间的取消订阅调用使用固定的标签。
+	if strings.Contains(output, "bogus") {
+		t.Error("unsubscribe for unknown namespace included in metrics")
+	}
+
+	// 取消订阅后活跃订阅数减少。
+	sub.Unsubscribe()
+	deadline := time.Now().Add(5 * time.Second)
+	for !containsLine(scrapeMetrics(t, server), `rpc_subscriptions_active{namespace="nftest"} 0`) {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription gauge not decremented")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func scrapeMetrics(t *testing.T, server *Server) string {
+	rec := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("content-type"); ct != metricsContentType {
+		t.Fatalf("wrong content type %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func containsLine(output, line string) bool {
+	for _, l := range strings.Split(output, "\n") {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
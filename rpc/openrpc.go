@@ -0,0 +1,353 @@
+package rpc
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openRPCVersion 是生成的文档所遵循的 OpenRPC 规范版本。
+const openRPCVersion = "1.2.6"
+
+// OpenRPCDocument 是 rpc_discover 返回的 OpenRPC 服务描述文档。
+// 参见 https://spec.open-rpc.org。
+type OpenRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       OpenRPCInfo       `json:"info"`
+	Methods    []OpenRPCMethod   `json:"methods"`
+	Components OpenRPCComponents `json:"components"`
+
+	// Subscriptions 列出通过 <namespace>_subscribe 创建的订阅。
+	// OpenRPC 没有描述订阅的方式，所以这里使用扩展字段。
+	Subscriptions []OpenRPCSubscription `json:"x-subscriptions,omitempty"`
+}
+
+// OpenRPCInfo 包含有关 API 的元数据。
+type OpenRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenRPCMethod 描述一个 RPC 方法。
+type OpenRPCMethod struct {
+	Name   string                     `json:"name"`
+	Params []OpenRPCContentDescriptor `json:"params"`
+	Result *OpenRPCContentDescriptor  `json:"result,omitempty"`
+	Errors []OpenRPCReference         `json:"errors,omitempty"`
+}
+
+// OpenRPCSubscription 描述一个订阅。订阅通过调用 Namespace_subscribe 并把
+// Name 作为第一个参数、Params 作为其余参数来创建。
+type OpenRPCSubscription struct {
+	Namespace string                     `json:"namespace"`
+	Name      string                     `json:"name"`
+	Params    []OpenRPCContentDescriptor `json:"params"`
+	Errors    []OpenRPCReference         `json:"errors,omitempty"`
+}
+
+// OpenRPCContentDescriptor 描述一个参数或结果。
+type OpenRPCContentDescriptor struct {
+	Name     string     `json:"name"`
+	Required bool       `json:"required,omitempty"`
+	Schema   JSONSchema `json:"schema"`
+}
+
+// OpenRPCReference 是指向 components 中条目的引用。
+type OpenRPCReference struct {
+	Ref string `json:"$ref"`
+}
+
+// OpenRPCComponents 包含可以被方法引用的共享定义。
+type OpenRPCComponents struct {
+	Schemas map[string]JSONSchema   `json:"schemas,omitempty"`
+	Errors  map[string]OpenRPCError `json:"errors,omitempty"`
+}
+
+// OpenRPCError 描述一个可能返回的错误。
+type OpenRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSONSchema 是参数和结果类型的 JSON Schema 描述。
+type JSONSchema struct {
+	Ref                  string                `json:"$ref,omitempty"`
+	Type                 string                `json:"type,omitempty"`
+	Items                *JSONSchema           `json:"items,omitempty"`
+	Properties           map[string]JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties *JSONSchema           `json:"additionalProperties,omitempty"`
+	Minimum              *int                  `json:"minimum,omitempty"`
+}
+
+// 文档中引用的错误名称。
+const (
+	openRPCErrInvalidParams = "InvalidParams"
+	openRPCErrInternal      = "InternalError"
+	openRPCErrServer        = "ServerError"
+	openRPCErrNotifications = "NotificationsUnsupported"
+)
+
+var openRPCErrors = map[string]OpenRPCError{
+	openRPCErrInvalidParams: {Code: -32602, Message: "invalid params"},
+	openRPCErrInternal:      {Code: errcodePanic, Message: "method handler crashed"},
+	openRPCErrServer:        {Code: errcodeDefault, Message: "method returned an error"},
+	openRPCErrNotifications: {Code: errcodeNotificationsUnsupported, Message: ErrNotificationsUnsupported.Error()},
+	"MethodNotFound":        {Code: -32601, Message: "method not found"},
+	"ParseError":            {Code: -32700, Message: "parse error"},
+	"InvalidRequest":        {Code: -32600, Message: "invalid request"},
+	"Timeout":               {Code: errcodeTimeout, Message: errMsgTimeout},
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Discover 返回描述服务器提供的所有方法和订阅的 OpenRPC 文档。
+// 只包含提供调用的入口可用的命名空间。
+func (s *RPCService) Discover(ctx context.Context) *OpenRPCDocument {
+	s.server.services.mu.Lock()
+	defer s.server.services.mu.Unlock()
+
+	allowed := modulesFromContext(ctx)
+	doc := &OpenRPCDocument{
+		OpenRPC: openRPCVersion,
+		Info:    OpenRPCInfo{Title: "JSON-RPC API", Version: "1.0"},
+		Methods: []OpenRPCMethod{},
+		Components: OpenRPCComponents{
+			Schemas: make(map[string]JSONSchema),
+			Errors:  openRPCErrors,
+		},
+	}
+	gen := &schemaGenerator{schemas: doc.Components.Schemas}
+
+	for _, namespace := range sortedKeys(s.server.services.services) {
+		if !allowed.allows(namespace) {
+			continue
+		}
+		svc := s.server.services.services[namespace]
+		for _, name := range sortedKeys(svc.callbacks) {
+			cb := svc.callbacks[name]
+			m := OpenRPCMethod{
+				Name:   namespace + serviceMethodSeparator + name,
+				Params: gen.params(cb.argTypes),
+				Errors: methodErrors(cb),
+			}
+			if rt := cb.resultType(); rt != nil {
+				m.Result = &OpenRPCContentDescriptor{Name: "result", Schema: gen.schema(rt)}
+			}
+			doc.Methods = append(doc.Methods, m)
+		}
+		for _, name := range sortedKeys(svc.subscriptions) {
+			cb := svc.subscriptions[name]
+			errs := append(methodErrors(cb), OpenRPCReference{errorRef(openRPCErrNotifications)})
+			doc.Subscriptions = append(doc.Subscriptions, OpenRPCSubscription{
+				Namespace: namespace,
+				Name:      name,
+				Params:    gen.params(cb.argTypes),
+				Errors:    errs,
+			})
+		}
+	}
+	return doc
+}
+
+// resultType 返回回调的非错误返回值的类型，如果没有则返回 nil。
+func (c *callback) resultType() reflect.Type {
+	fntype := c.fn.Type()
+	if fntype.NumOut() == 0 || c.errPos == 0 {
+		return nil
+	}
+	return fntype.Out(0)
+}
+
+func methodErrors(cb *callback) []OpenRPCReference {
+	var refs []OpenRPCReference
+	if len(cb.argTypes) > 0 {
+		refs = append(refs, OpenRPCReference{errorRef(openRPCErrInvalidParams)})
+	}
+	if cb.errPos >= 0 {
+		refs = append(refs, OpenRPCReference{errorRef(openRPCErrServer)})
+	}
+	return append(refs, OpenRPCReference{errorRef(openRPCErrInternal)})
+}
+
+func errorRef(name string) string {
+	return "#/components/errors/" + name
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// schemaGenerator 从 Go 类型生成 JSON Schema。结构体类型被放入
+// schemas 并通过 $ref 引用，这样递归类型也能被描述。
+type schemaGenerator struct {
+	schemas map[string]JSONSchema
+	names   map[reflect.Type]string // 已生成的结构体类型的名称
+}
+
+// params 为参数列表生成内容描述符。Go 不保留参数名称，所以参数
+// 按位置命名。指针类型的参数是可选的。
+func (g *schemaGenerator) params(types []reflect.Type) []OpenRPCContentDescriptor {
+	params := make([]OpenRPCContentDescriptor, len(types))
+	for i, t := range types {
+		params[i] = OpenRPCContentDescriptor{
+			Name:     "arg" + strconv.Itoa(i),
+			Required: t.Kind() != reflect.Ptr,
+			Schema:   g.schema(t),
+		}
+	}
+	return params
+}
+
+// schema 返回类型 t 的 JSON 编码的描述。指针被描述为其指向的类型。
+func (g *schemaGenerator) schema(t reflect.Type) JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// 自定义编码的类型无法通过反射得知其结构。
+	switch {
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+			return JSONSchema{Type: "string"}
+		}
+		return JSONSchema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return JSONSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return JSONSchema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		min := 0
+		return JSONSchema{Type: "integer", Minimum: &min}
+	case reflect.Float32, reflect.Float64:
+		return JSONSchema{Type: "number"}
+	case reflect.String:
+		return JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return JSONSchema{Type: "string"} // []byte 被编码为 base64
+		}
+		items := g.schema(t.Elem())
+		return JSONSchema{Type: "array", Items: &items}
+	case reflect.Map:
+		values := g.schema(t.Elem())
+		return JSONSchema{Type: "object", AdditionalProperties: &values}
+	case reflect.Struct:
+		return g.structSchema(t)
+	default:
+		// 接口和其他类型可以是任何值。
+		return JSONSchema{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) JSONSchema {
+	if t.Name() == "" {
+		return g.objectSchema(t)
+	}
+	if name, ok := g.names[t]; ok {
+		return JSONSchema{Ref: "#/components/schemas/" + name}
+	}
+	name := g.schemaName(t)
+	if g.names == nil {
+		g.names = make(map[reflect.Type]string)
+	}
+	g.names[t] = name
+	// 在生成字段之前占位，防止递归类型无限展开。
+	g.schemas[name] = JSONSchema{}
+	g.schemas[name] = g.objectSchema(t)
+	return JSONSchema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *schemaGenerator) objectSchema(t reflect.Type) JSONSchema {
+	s := JSONSchema{Type: "object", Properties: make(map[string]JSONSchema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // 未导出的字段
+		}
+		name, skip := jsonFieldName(f)
+		if skip {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			// 嵌入的结构体的字段被提升到外层对象中。
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range g.objectSchema(ft).Properties {
+					s.Properties[k] = v
+				}
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			name = f.Name
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+	}
+	return s
+}
+
+// jsonFieldName 返回 encoding/json 为结构体字段使用的名称。
+func jsonFieldName(f reflect.StructField) (name string, skip bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name = strings.Split(tag, ",")[0]
+	return name, false
+}
+
+// schemaName 返回结构体类型在 components.schemas 中使用的名称。名称通常
+// 由包名和类型名组成。如果该名称已被另一个包中的同名类型占用，则改用
+// 完整的导入路径，必要时再加上数字后缀。
+func (g *schemaGenerator) schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if pkg == "" {
+		return g.uniqueName(t.Name())
+	}
+	short := pkg
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		short = pkg[i+1:]
+	}
+	if name := short + "." + t.Name(); !g.taken(name) {
+		return name
+	}
+	// 导入路径中的 '/' 在 $ref 中需要转义，所以替换为 '.'。
+	return g.uniqueName(strings.ReplaceAll(pkg, "/", ".") + "." + t.Name())
+}
+
+// uniqueName 返回 name，如果 name 已被占用则为其加上数字后缀。
+func (g *schemaGenerator) uniqueName(name string) string {
+	unique := name
+	for i := 2; g.taken(unique); i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	return unique
+}
+
+func (g *schemaGenerator) taken(name string) bool {
+	_, ok := g.schemas[name]
+	return ok
+}
@@ -0,0 +1,150 @@
+package rpc
+
+import (
+	atypes "flychain/rpc/testdata/schema/a/types"
+	btypes "flychain/rpc/testdata/schema/b/types"
+	"reflect"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var doc OpenRPCDocument
+	if err := client.Call(&doc, "rpc_discover"); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenRPC != openRPCVersion {
+		t.Errorf("wrong openrpc version %q", doc.OpenRPC)
+	}
+
+	methods := make(map[string]OpenRPCMethod)
+	for _, m := range doc.Methods {
+		methods[m.Name] = m
+	}
+	for _, name := range []string{"rpc_modules", "rpc_discover", "test_echo", "test_noArgsRets", "nftest_echo"} {
+		if _, ok := methods[name]; !ok {
+			t.Errorf("method %s missing from document", name)
+		}
+	}
+
+	// test_echo(string, int, *echoArgs) echoResult
+	echo := methods["test_echo"]
+	wantParams := []OpenRPCContentDescriptor{
+		{Name: "arg0", Required: true, Schema: JSONSchema{Type: "string"}},
+		{Name: "arg1", Required: true, Schema: JSONSchema{Type: "integer"}},
+		{Name: "arg2", Required: false, Schema: JSONSchema{Ref: "#/components/schemas/rpc.echoArgs"}},
+	}
+	if !reflect.DeepEqual(echo.Params, wantParams) {
+		t.Errorf("wrong test_echo params:\ngot  %+v\nwant %+v", echo.Params, wantParams)
+	}
+	if echo.Result == nil || echo.Result.Schema.Ref != "#/components/schemas/rpc.echoResult" {
+		t.Errorf("wrong test_echo result %+v", echo.Result)
+	}
+	wantResult := JSONSchema{Type: "object", Properties: map[string]JSONSchema{
+		"String": {Type: "string"},
+		"Int":    {Type: "integer"},
+		"Args":   {Ref: "#/components/schemas/rpc.echoArgs"},
+	}}
+	if s := doc.Components.Schemas["rpc.echoResult"]; !reflect.DeepEqual(s, wantResult) {
+		t.Errorf("wrong echoResult schema %+v", s)
+	}
+
+	// 没有返回值的方法没有结果，返回错误的方法引用 ServerError。
+	if m := methods["test_noArgsRets"]; m.Result != nil || len(m.Params) != 0 {
+		t.Errorf("wrong test_noArgsRets description %+v", m)
+	}
+	if m := methods["test_returnError"]; !containsRef(m.Errors, errorRef(openRPCErrServer)) {
+		t.Errorf("test_returnError does not reference %s: %+v", openRPCErrServer, m.Errors)
+	}
+	for _, ref := range methods["test_echo"].Errors {
+		if ref.Ref == errorRef(openRPCErrServer) {
+			t.Error("test_echo cannot return an error but references ServerError")
+		}
+	}
+	if e := doc.Components.Errors[openRPCErrInvalidParams]; e.Code != -32602 {
+		t.Errorf("wrong InvalidParams error %+v", e)
+	}
+
+	// 订阅方法不作为普通方法列出。
+	if _, ok := methods["nftest_someSubscription"]; ok {
+		t.Error("subscription listed as method")
+	}
+	var found bool
+	for _, sub := range doc.Subscriptions {
+		if sub.Namespace == "nftest" && sub.Name == "someSubscription" {
+			found = true
+			if len(sub.Params) != 2 || sub.Params[0].Schema.Type != "integer" {
+				t.Errorf("wrong someSubscription params %+v", sub.Params)
+			}
+		}
+	}
+	if !found {
+		t.Error("someSubscription missing from document")
+	}
+}
+
+type recursiveType struct {
+	Name     string           `json:"name"`
+	Children []*recursiveType `json:"children,omitempty"`
+	Skipped  int              `json:"-"`
+	hidden   int
+	embeddedFields
+}
+
+type embeddedFields struct {
+	Extra []byte
+	Meta  map[string]uint8
+}
+
+func TestSchemaGeneratorStructs(t *testing.T) {
+	gen := &schemaGenerator{schemas: make(map[string]JSONSchema)}
+	ref := gen.schema(reflect.TypeOf(&recursiveType{}))
+	if ref.Ref != "#/components/schemas/rpc.recursiveType" {
+		t.Fatalf("wrong reference %+v", ref)
+	}
+	zero := 0
+	want := JSONSchema{Type: "object", Properties: map[string]JSONSchema{
+		"name":     {Type: "string"},
+		"children": {Type: "array", Items: &JSONSchema{Ref: "#/components/schemas/rpc.recursiveType"}},
+		"Extra":    {Type: "string"},
+		"Meta":     {Type: "object", AdditionalProperties: &JSONSchema{Type: "integer", Minimum: &zero}},
+	}}
+	if got := gen.schemas["rpc.recursiveType"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong schema:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestSchemaGeneratorNameCollision(t *testing.T) {
+	gen := &schemaGenerator{schemas: make(map[string]JSONSchema)}
+	refA := gen.schema(reflect.TypeOf(atypes.Header{}))
+	refB := gen.schema(reflect.TypeOf(btypes.Header{}))
+	if refA.Ref != "#/components/schemas/types.Header" {
+		t.Fatalf("wrong reference %+v", refA)
+	}
+	if refB.Ref != "#/components/schemas/flychain.rpc.testdata.schema.b.types.Header" {
+		t.Fatalf("wrong reference %+v", refB)
+	}
+	// 再次生成时引用不变。
+	if ref := gen.schema(reflect.TypeOf(&btypes.Header{})); ref.Ref != refB.Ref {
+		t.Fatalf("wrong reference %+v", ref)
+	}
+	if _, ok := gen.schemas["types.Header"].Properties["Number"]; !ok {
+		t.Errorf("wrong schema for a/types.Header: %+v", gen.schemas["types.Header"])
+	}
+	if _, ok := gen.schemas["flychain.rpc.testdata.schema.b.types.Header"].Properties["Hash"]; !ok {
+		t.Errorf("wrong schema for b/types.Header: %+v", gen.schemas)
+	}
+}
+
+func containsRef(refs []OpenRPCReference, ref string) bool {
+	for _, r := range refs {
+		if r.Ref == ref {
+			return true
+		}
+	}
+	return false
+}
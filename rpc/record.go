@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"flychain/log"
+	"io"
+	"sync"
+	"time"
+)
+
+// 记录中消息的方向。
+const (
+	RecordInbound  = "in"  // 编解码器读取的消息
+	RecordOutbound = "out" // 编解码器写入的消息
+)
+
+// RecordEntry 是 NewRecordingCodec 写入的一行记录。
+type RecordEntry struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"dir"` // RecordInbound 或 RecordOutbound
+	Message   json.RawMessage `json:"msg"` // 单个消息，或者批处理的消息数组
+}
+
+// recordingCodec 把经过编解码器的所有消息写入记录。
+type recordingCodec struct {
+	ServerCodec
+
+	mu     sync.Mutex
+	enc    *json.Encoder
+	failed bool // 写入记录是否失败过
+}
+
+// NewRecordingCodec 包装 codec，把它读取和写入的每条 JSON-RPC 消息连同时间戳
+// 以 JSONL 格式写入 w，每行一个 RecordEntry。Replay 可以把这样的记录重放给服务器。
+//
+// 写入 w 失败不会影响连接，只会记录一条警告日志。w 的写入是串行的。
+func NewRecordingCodec(codec ServerCodec, w io.Writer) ServerCodec {
+	return &recordingCodec{ServerCodec: codec, enc: json.NewEncoder(w)}
+}
+
+func (c *recordingCodec) readBatch() ([]*jsonrpcMessage, bool, error) {
+	msgs, batch, err := c.ServerCodec.readBatch()
+	if err == nil {
+		if batch {
+			c.record(RecordInbound, msgs)
+		} else {
+			c.record(RecordInbound, msgs[0])
+		}
+	}
+	return msgs, batch, err
+}
+
+func (c *recordingCodec) writeJSON(ctx context.Context, v interface{}, isErrorResponse bool) error {
+	// 在写入之前记录，这样对端收到响应时记录中已经有它了。
+	c.record(RecordOutbound, v)
+	return c.ServerCodec.writeJSON(ctx, v, isErrorResponse)
+}
+
+func (c *recordingCodec) record(dir string, v interface{}) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err = c.enc.Encode(&RecordEntry{Time: time.Now(), Direction: dir, Message: msg})
+	if err != nil && !c.failed {
+		c.failed = true
+		log.Warn("Failed to record RPC message", "conn", c.remoteAddr(), "err", err)
+	}
+}
@@ -0,0 +1,210 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer 是可以并发写入的 bytes.Buffer。
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+// dialRecording 像 DialInProc 一样连接到服务器，并把服务器端的消息记录到 w。
+func dialRecording(server *Server, w io.Writer) *Client {
+	c, _ := newClient(context.Background(), func(context.Context) (ServerCodec, error) {
+		p1, p2 := net.Pipe()
+		go server.ServeCodec(NewRecordingCodec(NewCodec(p1), w), 0)
+		return NewCodec(p2), nil
+	})
+	return c
+}
+
+// recordSession 对服务器执行一组调用，返回记录。
+func recordSession(t *testing.T) []byte {
+	server := newTestServer()
+	defer server.Stop()
+	rec := new(lockedBuffer)
+	client := dialRecording(server, rec)
+	defer client.Close()
+
+	var echo echoResult
+	if err := client.Call(&echo, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	batch := []BatchElem{
+		{Method: "test_repeat", Args: []interface{}{"a", 3}, Result: new(string)},
+		{Method: "test_returnError", Result: new(string)},
+		{Method: "no_such_method", Result: new(string)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan int)
+	sub, err := client.Subscribe(context.Background(), "nftest", ch, "someSubscription", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	<-ch
+	sub.Unsubscribe()
+	return rec.Bytes()
+}
+
+func TestRecordingCodec(t *testing.T) {
+	recording := recordSession(t)
+	entries, err := readRecording(bytes.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inbound []string
+	var notifications int
+	for _, e := range entries {
+		if e.Time.IsZero() {
+			t.Errorf("entry without time: %s", e.Message)
+		}
+		msgs, batch := parseMessage(e.Message)
+		switch e.Direction {
+		case RecordInbound:
+			var methods []string
+			for _, msg := range msgs {
+				methods = append(methods, msg.Method)
+			}
+			if batch {
+				inbound = append(inbound, "["+strings.Join(methods, ",")+"]")
+			} else {
+				inbound = append(inbound, methods...)
+			}
+		case RecordOutbound:
+			for _, msg := range msgs {
+				if msg.Method == "nftest_subscription" {
+					notifications++
+				}
+			}
+		}
+	}
+	want := []string{
+		"test_echo",
+		"[test_repeat,test_returnError,no_such_method]",
+		"nftest_subscribe",
+		"nftest_unsubscribe",
+	}
+	if !reflect.DeepEqual(inbound, want) {
+		t.Errorf("wrong inbound messages %q, want %q", inbound, want)
+	}
+	if notifications != 2 {
+		t.Errorf("wrong number of recorded notifications %d", notifications)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	recording := recordSession(t)
+
+	// 重放到使用随机订阅 ID 的服务器。取消订阅必须使用新的 ID。
+	server := newTestServer()
+	server.idgen = randomIDGenerator()
+	defer server.Stop()
+	mismatches, err := Replay(server, bytes.NewReader(recording), ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mismatches {
+		t.Errorf("unexpected mismatch in entry %d: %s: want %s, got %s", m.Entry, m.Request, m.Want, m.Got)
+	}
+
+	// 修改记录的响应。
+	changed := bytes.Replace(recording, []byte(`"result":"aaa"`), []byte(`"result":"bbb"`), 1)
+	if bytes.Equal(changed, recording) {
+		t.Fatal("test_repeat response not found in recording")
+	}
+	mismatches, err = Replay(server, bytes.NewReader(changed), ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 {
+		t.Fatalf("wrong number of mismatches %d, want 1", len(mismatches))
+	}
+	m := mismatches[0]
+	if !strings.Contains(string(m.Request), "test_repeat") || !strings.Contains(string(m.Want), "bbb") || !strings.Contains(string(m.Got), "aaa") {
+		t.Errorf("wrong mismatch: %s: want %s, got %s", m.Request, m.Want, m.Got)
+	}
+
+	// 被忽略的字段不参与比较。
+	mismatches, err = Replay(server, bytes.NewReader(changed), ReplayOptions{Ignore: []string{"result"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("ignored field caused %d mismatches", len(mismatches))
+	}
+}
+
+func TestReplayTimeout(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	recording := `{"time":"2023-01-01T00:00:00Z","dir":"in","msg":{"jsonrpc":"2.0","id":1,"method":"test_block"}}
+{"time":"2023-01-01T00:00:01Z","dir":"out","msg":{"jsonrpc":"2.0","id":1,"result":null}}
+{"time":"2023-01-01T00:00:02Z","dir":"in","msg":{"jsonrpc":"2.0","id":2,"method":"test_repeat","params":["x",2]}}
+{"time":"2023-01-01T00:00:03Z","dir":"out","msg":{"jsonrpc":"2.0","id":2,"result":"xx"}}
+`
+	mismatches, err := Replay(server, strings.NewReader(recording), ReplayOptions{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 {
+		t.Fatalf("wrong number of mismatches %d, want 1", len(mismatches))
+	}
+	if m := mismatches[0]; m.Entry != 1 || m.Got != nil || string(m.Want) != `{"jsonrpc":"2.0","id":1,"result":null}` {
+		t.Errorf("wrong mismatch: entry %d: want %s, got %s", m.Entry, m.Want, m.Got)
+	}
+
+	if _, err := Replay(server, strings.NewReader(`{"dir":"sideways"}`), ReplayOptions{}); err == nil {
+		t.Error("expected error for invalid recording")
+	}
+}
+
+func TestDeleteJSONPath(t *testing.T) {
+	tests := []struct {
+		path string
+		in   string
+		want string
+	}{
+		{"result", `{"id":1,"result":2}`, `{"id":1}`},
+		{"result.timestamp", `{"result":{"timestamp":1,"number":2}}`, `{"result":{"number":2}}`},
+		{"result.*.hash", `{"result":[{"hash":1,"n":1},{"hash":2,"n":2}]}`, `{"result":[{"n":1},{"n":2}]}`},
+		{"result.1", `{"result":[1,2,3]}`, `{"result":[1,null,3]}`},
+		{"error.data", `{"result":1}`, `{"result":1}`},
+	}
+	for _, test := range tests {
+		var v interface{}
+		json.Unmarshal([]byte(test.in), &v)
+		deleteJSONPath(v, strings.Split(test.path, "."))
+		got, _ := json.Marshal(v)
+		if string(got) != test.want {
+			t.Errorf("%s %s: got %s, want %s", test.path, test.in, got, test.want)
+		}
+	}
+}
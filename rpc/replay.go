@@ -0,0 +1,404 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultReplayTimeout = 10 * time.Second
+
+var errReplayStalled = errors.New("server did not read replayed message")
+
+// ReplayOptions 配置 Replay。
+type ReplayOptions struct {
+	// Ignore 列出比较响应时忽略的字段，路径以点分隔，例如 "result.timestamp"
+	// 或 "error.data"。"*" 匹配任意对象键或数组下标。
+	Ignore []string
+
+	// Timeout 是等待单条消息的响应的最长时间，零表示 10 秒。
+	Timeout time.Duration
+}
+
+// ReplayMismatch 描述一个与记录不一致的响应。
+type ReplayMismatch struct {
+	Entry   int             // 请求在记录中的行号，从 1 开始
+	Request json.RawMessage // 重放的请求
+	Want    json.RawMessage // 记录的响应，记录中没有响应时为 nil
+	Got     json.RawMessage // 重放得到的响应，超时没有响应时为 nil
+}
+
+// Replay 把 NewRecordingCodec 写入的记录中的入站消息依次发送给 srv，
+// 并把服务器的响应与记录中相同 ID 的响应比较，返回所有不一致的响应。
+// 只有读取记录或者向服务器发送消息失败时才返回错误。
+//
+// 每条消息在上一条消息的所有响应到达或者超时之后才被发送，因此重放的结果
+// 不依赖于记录时调用的并发情况。比较时忽略 opts.Ignore 中的字段。
+// 订阅 ID 在每次运行时都不同：订阅调用的结果不参与比较，之后请求参数中
+// 记录的订阅 ID 被替换为重放时得到的 ID。订阅通知是异步发送的，不参与比较。
+func Replay(srv *Server, r io.Reader, opts ReplayOptions) ([]ReplayMismatch, error) {
+	entries, err := readRecording(r)
+	if err != nil {
+		return nil, err
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultReplayTimeout
+	}
+	ignore := make([][]string, len(opts.Ignore))
+	for i, path := range opts.Ignore {
+		ignore[i] = strings.Split(path, ".")
+	}
+
+	// 按 ID 收集记录的响应。
+	recorded := make(map[string][]recordedResponse)
+	for i, e := range entries {
+		if e.Direction != RecordOutbound {
+			continue
+		}
+		msgs, _ := parseMessage(e.Message)
+		for _, msg := range msgs {
+			if msg != nil && msg.isResponse() {
+				id := string(msg.ID)
+				recorded[id] = append(recorded[id], recordedResponse{i, msg})
+			}
+		}
+	}
+
+	codec := newReplayCodec()
+	defer codec.close()
+	go srv.ServeCodec(codec, 0)
+
+	var (
+		mismatches []ReplayMismatch
+		subIDs     = make(map[string]string) // 记录的订阅 ID => 重放得到的订阅 ID
+	)
+	for i, e := range entries {
+		if e.Direction != RecordInbound {
+			continue
+		}
+		msgs, batch := parseMessage(e.Message)
+		for j, msg := range msgs {
+			if msg == nil {
+				msgs[j] = new(jsonrpcMessage)
+			}
+			replaceSubscriptionIDs(msgs[j], subIDs)
+		}
+		// 找到需要响应的消息。空的批处理得到一个 ID 为 null 的错误响应。
+		var (
+			reqs []*jsonrpcMessage
+			keys []string
+		)
+		for _, msg := range msgs {
+			if key, ok := replayResponseKey(msg); ok {
+				reqs = append(reqs, msg)
+				keys = append(keys, key)
+			}
+		}
+		if batch && len(msgs) == 0 {
+			reqs, keys = []*jsonrpcMessage{nil}, []string{string(null)}
+		}
+
+		if err := codec.send(msgs, batch, timeout); err != nil {
+			return mismatches, err
+		}
+		got := codec.collect(keys, timeout)
+
+		for j, req := range reqs {
+			var (
+				key        = keys[j]
+				want       = popRecordedResponse(recorded, key, i)
+				resp       *jsonrpcMessage
+				reqIgnore  = ignore
+				reqEncoded = e.Message
+			)
+			if len(got[key]) > 0 {
+				resp, got[key] = got[key][0], got[key][1:]
+			}
+			if want == nil && resp == nil {
+				continue
+			}
+			if req != nil {
+				reqEncoded, _ = json.Marshal(req)
+				if req.isSubscribe() {
+					recordSubscriptionID(subIDs, want, resp)
+					reqIgnore = append([][]string{{"result"}}, ignore...)
+				}
+			}
+			if !replayEqual(want, resp, reqIgnore) {
+				mismatches = append(mismatches, ReplayMismatch{
+					Entry:   i + 1,
+					Request: reqEncoded,
+					Want:    encodeReplayMessage(want),
+					Got:     encodeReplayMessage(resp),
+				})
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+type recordedResponse struct {
+	entry int
+	msg   *jsonrpcMessage
+}
+
+// readRecording 读取 JSONL 格式的记录。
+func readRecording(r io.Reader) ([]RecordEntry, error) {
+	var (
+		dec     = json.NewDecoder(r)
+		entries []RecordEntry
+	)
+	for {
+		var e RecordEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recording entry %d: %v", len(entries)+1, err)
+		}
+		if e.Direction != RecordInbound && e.Direction != RecordOutbound {
+			return nil, fmt.Errorf("invalid recording entry %d: unknown direction %q", len(entries)+1, e.Direction)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// replayResponseKey 返回服务器对 msg 的响应的 ID。如果 msg 不需要响应，ok 为 false。
+func replayResponseKey(msg *jsonrpcMessage) (key string, ok bool) {
+	switch {
+	case msg.isNotification() || msg.isResponse():
+		return "", false
+	case msg.hasValidID():
+		return string(msg.ID), true
+	default:
+		return string(null), true
+	}
+}
+
+// popRecordedResponse 返回并删除记录中 entry 之后第一个 ID 为 key 的响应。
+func popRecordedResponse(recorded map[string][]recordedResponse, key string, entry int) *jsonrpcMessage {
+	list := recorded[key]
+	for i, r := range list {
+		if r.entry > entry {
+			recorded[key] = append(list[:i:i], list[i+1:]...)
+			return r.msg
+		}
+	}
+	return nil
+}
+
+// recordSubscriptionID 记住订阅调用在记录和重放中得到的订阅 ID。
+func recordSubscriptionID(subIDs map[string]string, want, got *jsonrpcMessage) {
+	if want == nil || got == nil {
+		return
+	}
+	var oldID, newID string
+	if json.Unmarshal(want.Result, &oldID) == nil && json.Unmarshal(got.Result, &newID) == nil {
+		subIDs[oldID] = newID
+	}
+}
+
+// replaceSubscriptionIDs 把参数中记录的订阅 ID 替换为重放得到的 ID。
+func replaceSubscriptionIDs(msg *jsonrpcMessage, subIDs map[string]string) {
+	if len(msg.Params) == 0 {
+		return
+	}
+	for oldID, newID := range subIDs {
+		o, _ := json.Marshal(oldID)
+		n, _ := json.Marshal(newID)
+		msg.Params = bytes.ReplaceAll(msg.Params, o, n)
+	}
+}
+
+func encodeReplayMessage(msg *jsonrpcMessage) json.RawMessage {
+	if msg == nil {
+		return nil
+	}
+	enc, _ := json.Marshal(msg)
+	return enc
+}
+
+// replayEqual 比较两个响应，忽略 ignore 中的字段。
+func replayEqual(want, got *jsonrpcMessage, ignore [][]string) bool {
+	if want == nil || got == nil {
+		return want == got
+	}
+	w, g := normalizeReplayMessage(want), normalizeReplayMessage(got)
+	for _, path := range ignore {
+		deleteJSONPath(w, path)
+		deleteJSONPath(g, path)
+	}
+	return reflect.DeepEqual(w, g)
+}
+
+func normalizeReplayMessage(msg *jsonrpcMessage) interface{} {
+	dec := json.NewDecoder(bytes.NewReader(encodeReplayMessage(msg)))
+	dec.UseNumber()
+	var v interface{}
+	dec.Decode(&v)
+	return v
+}
+
+// deleteJSONPath 删除解码后的 JSON 值 v 中与 path 匹配的字段。
+// 数组元素不能删除，匹配的元素被替换为 nil。
+func deleteJSONPath(v interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if path[0] != "*" && path[0] != k {
+				continue
+			}
+			if len(path) == 1 {
+				delete(v, k)
+			} else {
+				deleteJSONPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if path[0] != "*" && path[0] != strconv.Itoa(i) {
+				continue
+			}
+			if len(path) == 1 {
+				v[i] = nil
+			} else {
+				deleteJSONPath(child, path[1:])
+			}
+		}
+	}
+}
+
+// replayCodec 是 Replay 使用的内存编解码器。写入永远不会阻塞，
+// 消息被缓存到 collect 取走为止。
+type replayCodec struct {
+	in      chan replayInput
+	closer  sync.Once
+	closeCh chan interface{}
+
+	mu      sync.Mutex
+	out     []*jsonrpcMessage
+	written chan struct{} // 有新的消息写入时收到通知
+}
+
+type replayInput struct {
+	msgs  []*jsonrpcMessage
+	batch bool
+}
+
+func newReplayCodec() *replayCodec {
+	return &replayCodec{
+		in:      make(chan replayInput),
+		closeCh: make(chan interface{}),
+		written: make(chan struct{}, 1),
+	}
+}
+
+func (c *replayCodec) peerInfo() PeerInfo {
+	return PeerInfo{Transport: "replay"}
+}
+
+func (c *replayCodec) remoteAddr() string {
+	return ""
+}
+
+func (c *replayCodec) readBatch() ([]*jsonrpcMessage, bool, error) {
+	select {
+	case in := <-c.in:
+		return in.msgs, in.batch, nil
+	case <-c.closeCh:
+		return nil, false, io.EOF
+	}
+}
+
+func (c *replayCodec) writeJSON(ctx context.Context, v interface{}, isErrorResponse bool) error {
+	enc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	msgs, _ := parseMessage(enc)
+
+	c.mu.Lock()
+	c.out = append(c.out, msgs...)
+	c.mu.Unlock()
+	select {
+	case c.written <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *replayCodec) close() {
+	c.closer.Do(func() { close(c.closeCh) })
+}
+
+func (c *replayCodec) closed() <-chan interface{} {
+	return c.closeCh
+}
+
+// send 把消息交给服务器。
+func (c *replayCodec) send(msgs []*jsonrpcMessage, batch bool, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case c.in <- replayInput{msgs, batch}:
+		return nil
+	case <-timer.C:
+		return errReplayStalled
+	}
+}
+
+// collect 等待 ID 为 keys 的响应，直到全部到达或者超时。其他写入的消息被丢弃。
+func (c *replayCodec) collect(keys []string, timeout time.Duration) map[string][]*jsonrpcMessage {
+	var (
+		got     = make(map[string][]*jsonrpcMessage)
+		missing = make(map[string]int)
+		timer   = time.NewTimer(timeout)
+	)
+	defer timer.Stop()
+	for _, key := range keys {
+		missing[key]++
+	}
+	for len(missing) > 0 {
+		c.mu.Lock()
+		out := c.out
+		c.out = nil
+		c.mu.Unlock()
+
+		for _, msg := range out {
+			if msg == nil || !msg.isResponse() {
+				continue
+			}
+			key := string(msg.ID)
+			if missing[key] == 0 {
+				continue
+			}
+			got[key] = append(got[key], msg)
+			if missing[key]--; missing[key] == 0 {
+				delete(missing, key)
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		select {
+		case <-c.written:
+		case <-timer.C:
+			return got
+		}
+	}
+	return got
+}
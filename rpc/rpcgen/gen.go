@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// notifyDirective 是方法文档注释中声明订阅通知类型的指令，例如：
+//
+//	//rpcgen:notify *Header
+//	func (api *API) NewHeads(ctx context.Context) (*rpc.Subscription, error)
+//
+// 服务器无法从方法签名得知通知的类型，没有此指令的订阅
+// 在生成的代码中使用 interface{} 类型的通道。
+const notifyDirective = "//rpcgen:notify "
+
+// buildContext 保存分析服务类型所需的数据。
+type buildContext struct {
+	packageRPC       *types.Package
+	subscriptionType types.Type
+	errorIface       *types.Interface
+
+	fset  *token.FileSet
+	files []*ast.File // 服务类型所在包的语法树，用于读取指令
+}
+
+func newBuildContext(packageRPC *types.Package, fset *token.FileSet, files []*ast.File) *buildContext {
+	sub := packageRPC.Scope().Lookup("Subscription").Type()
+	errt := types.Universe.Lookup("error").Type().Underlying()
+	return &buildContext{
+		packageRPC:       packageRPC,
+		subscriptionType: sub,
+		errorIface:       errt.(*types.Interface),
+		fset:             fset,
+		files:            files,
+	}
+}
+
+// rpcMethod 是服务类型的一个 RPC 方法或订阅。
+type rpcMethod struct {
+	name      string       // Go 方法名
+	wireName  string       // 方法名的 RPC 形式，参见 rpc.formatName
+	params    []*types.Var // 不包括 context.Context 参数
+	result    types.Type   // 方法没有结果时为 nil
+	subscribe bool
+	notify    types.Type // 订阅的通知类型，未知时为 nil
+}
+
+// isContext 报告 t 是否为 context.Context。
+func isContext(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "context" && obj.Name() == "Context"
+}
+
+// isError 报告 t 或者 t 指向的类型是否实现了 error 接口，与 rpc.isErrorType 相同。
+func (bctx *buildContext) isError(t types.Type) bool {
+	return types.Implements(derefType(t), bctx.errorIface)
+}
+
+// isSubscription 报告 t 是否为 rpc.Subscription 或者指向它的指针。
+func (bctx *buildContext) isSubscription(t types.Type) bool {
+	return types.Identical(derefType(t), bctx.subscriptionType)
+}
+
+func derefType(t types.Type) types.Type {
+	for {
+		ptr, ok := t.(*types.Pointer)
+		if !ok {
+			return t
+		}
+		t = ptr.Elem()
+	}
+}
+
+// formatName 将名称的第一个字符转换为小写，与 rpc.formatName 相同。
+func formatName(name string) string {
+	ret := []rune(name)
+	if len(ret) > 0 {
+		ret[0] = unicode.ToLower(ret[0])
+	}
+	return string(ret)
+}
+
+// methods 返回 typ 的指针类型上所有能被 Server.RegisterName 注册的方法。
+// 规则与 rpc.suitableCallbacks 相同。
+func (bctx *buildContext) methods(typ *types.Named) ([]*rpcMethod, error) {
+	var (
+		mset    = types.NewMethodSet(types.NewPointer(typ))
+		methods []*rpcMethod
+	)
+	for i := 0; i < mset.Len(); i++ {
+		fn, ok := mset.At(i).Obj().(*types.Func)
+		if !ok || !fn.Exported() {
+			continue
+		}
+		m, err := bctx.makeMethod(fn)
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %v", fn.Name(), err)
+		}
+		if m != nil {
+			methods = append(methods, m)
+		}
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("type %s doesn't have any suitable methods/subscriptions to expose", typ.Obj().Name())
+	}
+	return methods, nil
+}
+
+// makeMethod 分析一个方法。如果方法不能作为 RPC 回调，则返回 nil。
+func (bctx *buildContext) makeMethod(fn *types.Func) (*rpcMethod, error) {
+	var (
+		sig    = fn.Type().(*types.Signature)
+		params = sig.Params()
+		res    = sig.Results()
+		m      = &rpcMethod{name: fn.Name(), wireName: formatName(fn.Name())}
+	)
+	first := 0
+	if params.Len() > 0 && isContext(params.At(0).Type()) {
+		first = 1
+	}
+	for i := first; i < params.Len(); i++ {
+		m.params = append(m.params, params.At(i))
+	}
+
+	// 订阅方法的第一个参数是 context.Context，返回 (*Subscription, error)。
+	if first == 1 && res.Len() == 2 && bctx.isSubscription(res.At(0).Type()) && bctx.isError(res.At(1).Type()) {
+		m.subscribe = true
+		notify, err := bctx.notifyType(fn)
+		if err != nil {
+			return nil, err
+		}
+		m.notify = notify
+		return m, nil
+	}
+
+	// 方法最多返回一个值和一个错误，错误必须是最后一个返回值。
+	switch {
+	case res.Len() > 2:
+		return nil, nil
+	case res.Len() == 2:
+		if bctx.isError(res.At(0).Type()) || !bctx.isError(res.At(1).Type()) {
+			return nil, nil
+		}
+		m.result = res.At(0).Type()
+	case res.Len() == 1 && !bctx.isError(res.At(0).Type()):
+		m.result = res.At(0).Type()
+	}
+	return m, nil
+}
+
+// notifyType 从方法的文档注释中读取通知类型。
+func (bctx *buildContext) notifyType(fn *types.Func) (types.Type, error) {
+	decl := bctx.funcDecl(fn)
+	if decl == nil || decl.Doc == nil {
+		return nil, nil
+	}
+	for _, c := range decl.Doc.List {
+		if !strings.HasPrefix(c.Text, notifyDirective) {
+			continue
+		}
+		expr := strings.TrimSpace(strings.TrimPrefix(c.Text, notifyDirective))
+		tv, err := types.Eval(bctx.fset, fn.Pkg(), c.Pos(), expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification type %q: %v", expr, err)
+		}
+		if !tv.IsType() {
+			return nil, fmt.Errorf("notification %q is not a type", expr)
+		}
+		return tv.Type, nil
+	}
+	return nil, nil
+}
+
+// funcDecl 返回方法的声明，如果它不在 bctx.files 中则返回 nil。
+func (bctx *buildContext) funcDecl(fn *types.Func) *ast.FuncDecl {
+	for _, f := range bctx.files {
+		for _, d := range f.Decls {
+			if decl, ok := d.(*ast.FuncDecl); ok && decl.Name.Pos() == fn.Pos() {
+				return decl
+			}
+		}
+	}
+	return nil
+}
+
+// genContext 跟踪生成的代码需要导入的包。
+type genContext struct {
+	inPackage  *types.Package
+	packageRPC *types.Package
+	imports    map[string]genImport // 导入路径 => 导入声明
+	names      map[string]string    // 生成的代码中使用的包名 => 导入路径
+}
+
+// genImport 是一个导入声明。不同的包可能有相同的名称，
+// 这时后导入的包使用带数字后缀的别名。
+type genImport struct {
+	name  string
+	alias bool
+}
+
+func newGenContext(inPackage, packageRPC *types.Package) *genContext {
+	return &genContext{
+		inPackage:  inPackage,
+		packageRPC: packageRPC,
+		imports:    make(map[string]genImport),
+		names:      make(map[string]string),
+	}
+}
+
+// addImport 导入给定路径和名称的包，并返回生成的代码中引用该包时使用的名称。
+func (ctx *genContext) addImport(path, name string) string {
+	if path == ctx.inPackage.Path() {
+		return "" // 不导入正在生成代码的包。
+	}
+	if imp, ok := ctx.imports[path]; ok {
+		return imp.name
+	}
+	unique := name
+	for i := 2; ctx.names[unique] != ""; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	ctx.imports[path] = genImport{name: unique, alias: unique != name}
+	ctx.names[unique] = path
+	return unique
+}
+
+// importsList 返回所有导入声明，按导入路径排序。
+func (ctx *genContext) importsList() []string {
+	paths := make([]string, 0, len(ctx.imports))
+	for path := range ctx.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	imp := make([]string, len(paths))
+	for i, path := range paths {
+		imp[i] = strconv.Quote(path)
+		if ctx.imports[path].alias {
+			imp[i] = ctx.imports[path].name + " " + imp[i]
+		}
+	}
+	return imp
+}
+
+// qualify 是打印类型时使用的 types.Qualifier。
+func (ctx *genContext) qualify(pkg *types.Package) string {
+	return ctx.addImport(pkg.Path(), pkg.Name())
+}
+
+// typeString 返回 t 在生成的代码中的写法。
+func (ctx *genContext) typeString(t types.Type) string {
+	return types.TypeString(t, ctx.qualify)
+}
+
+// rpc 返回 rpc 包中给定名称的标识符在生成的代码中的写法。
+func (ctx *genContext) rpc(name string) string {
+	if q := ctx.qualify(ctx.packageRPC); q != "" {
+		return q + "." + name
+	}
+	return name
+}
+
+// reservedNames 是生成的方法中使用的标识符，参数不能使用这些名称。
+var reservedNames = map[string]bool{
+	"c": true, "ctx": true, "channel": true, "context": true, "rpc": true,
+}
+
+// paramNames 返回生成的方法的参数名称。
+func paramNames(params []*types.Var) []string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		name := p.Name()
+		if name == "" || name == "_" || reservedNames[name] {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		names[i] = name
+	}
+	return names
+}
+
+func generateMethod(ctx *genContext, client, namespace string, m *rpcMethod) []byte {
+	var (
+		b     bytes.Buffer
+		names = paramNames(m.params)
+		decl  = []string{"ctx context.Context"}
+		args  []string
+	)
+	ctx.addImport("context", "context")
+	if m.subscribe {
+		chanType := "interface{}"
+		if m.notify != nil {
+			chanType = "chan<- " + ctx.typeString(m.notify)
+		}
+		decl = append(decl, "channel "+chanType)
+		args = append(args, fmt.Sprintf("%q", m.wireName))
+	}
+	for i, p := range m.params {
+		decl = append(decl, names[i]+" "+ctx.typeString(p.Type()))
+		args = append(args, names[i])
+	}
+	params := strings.Join(decl, ", ")
+	callArgs := ""
+	if len(args) > 0 {
+		callArgs = ", " + strings.Join(args, ", ")
+	}
+
+	switch {
+	case m.subscribe:
+		fmt.Fprintf(&b, "// Subscribe%s 订阅 %s_subscribe 的 %q 通知。\n", m.name, namespace, m.wireName)
+		fmt.Fprintf(&b, "func (c *%s) Subscribe%s(%s) (*%s, error) {\n", client, m.name, params, ctx.rpc("ClientSubscription"))
+		fmt.Fprintf(&b, "return c.c.Subscribe(ctx, %q, channel%s)\n", namespace, callArgs)
+	case m.result != nil:
+		result := ctx.typeString(m.result)
+		fmt.Fprintf(&b, "// %s 调用 %s_%s。\n", m.name, namespace, m.wireName)
+		fmt.Fprintf(&b, "func (c *%s) %s(%s) (%s, error) {\n", client, m.name, params, result)
+		fmt.Fprintf(&b, "return %s[%s](ctx, c.c, %q%s)\n", ctx.rpc("CallTyped"), result, namespace+"_"+m.wireName, callArgs)
+	default:
+		fmt.Fprintf(&b, "// %s 调用 %s_%s。\n", m.name, namespace, m.wireName)
+		fmt.Fprintf(&b, "func (c *%s) %s(%s) error {\n", client, m.name, params)
+		fmt.Fprintf(&b, "return c.c.CallContext(ctx, nil, %q%s)\n", namespace+"_"+m.wireName, callArgs)
+	}
+	fmt.Fprintln(&b, "}")
+	return b.Bytes()
+}
+
+// generate 为 typ 生成类型化的客户端。namespace 是服务注册时使用的名称，
+// client 是生成的客户端类型的名称。
+func (bctx *buildContext) generate(typ *types.Named, namespace, client string) ([]byte, error) {
+	methods, err := bctx.methods(typ)
+	if err != nil {
+		return nil, err
+	}
+	// 检查生成的方法名称是否冲突。
+	seen := make(map[string]string)
+	for _, m := range methods {
+		name := m.name
+		if m.subscribe {
+			name = "Subscribe" + m.name
+		}
+		if prev, ok := seen[name]; ok {
+			return nil, fmt.Errorf("generated method %s for %s conflicts with %s", name, m.name, prev)
+		}
+		seen[name] = m.name
+	}
+
+	var (
+		pkg  = typ.Obj().Pkg()
+		ctx  = newGenContext(pkg, bctx.packageRPC)
+		body bytes.Buffer
+	)
+	fmt.Fprintf(&body, "// %s 是 %s 服务的类型化客户端。\n", client, typ.Obj().Name())
+	fmt.Fprintf(&body, "type %s struct {\nc *%s\n}\n\n", client, ctx.rpc("Client"))
+	fmt.Fprintf(&body, "// New%s 创建一个通过 c 调用 %q 命名空间的客户端。\n", client, namespace)
+	fmt.Fprintf(&body, "func New%s(c *%s) *%s {\nreturn &%s{c: c}\n}\n", client, ctx.rpc("Client"), client, client)
+	for _, m := range methods {
+		fmt.Fprintln(&body)
+		body.Write(generateMethod(ctx, client, namespace, m))
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "package %s\n\n", pkg.Name())
+	for _, imp := range ctx.importsList() {
+		fmt.Fprintf(&b, "import %s\n", imp)
+	}
+	fmt.Fprintln(&b)
+	b.Write(body.Bytes())
+	return format.Source(b.Bytes())
+}
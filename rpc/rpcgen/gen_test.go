@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rpc 包只加载一次，在所有测试中重用。
+var (
+	testFset       = token.NewFileSet()
+	testImporter   = importer.ForCompiler(testFset, "source", nil).(types.ImporterFrom)
+	testPackageRPC *types.Package
+)
+
+func init() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	testPackageRPC, err = testImporter.ImportFrom(pathOfPackageRPC, cwd, 0)
+	if err != nil {
+		panic(fmt.Errorf("can't load package RPC: %v", err))
+	}
+}
+
+var tests = []string{"basic", "subscription", "imports"}
+
+func TestOutput(t *testing.T) {
+	for _, test := range tests {
+		test := test
+		t.Run(test, func(t *testing.T) {
+			inputFile := filepath.Join("testdata", test+".in.txt")
+			outputFile := filepath.Join("testdata", test+".out.txt")
+			bctx, typ, err := loadTestSource(inputFile, "Test")
+			if err != nil {
+				t.Fatal("error loading test source:", err)
+			}
+			output, err := bctx.generate(typ, "test", "TestClient")
+			if err != nil {
+				t.Fatal("error in generate:", err)
+			}
+
+			// 设置此环境变量以重新生成测试输出。
+			if os.Getenv("WRITE_TEST_FILES") != "" {
+				os.WriteFile(outputFile, output, 0644)
+			}
+
+			// 检查输出是否匹配。
+			wantOutput, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatal("error loading expected test output:", err)
+			}
+			if !bytes.Equal(output, wantOutput) {
+				t.Fatal("output mismatch:\n", string(output))
+			}
+
+			// 生成的代码必须能和输入一起编译。
+			if err := checkTestOutput(inputFile, output); err != nil {
+				t.Fatal("generated code doesn't compile:", err)
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := map[string]string{
+		"noMethods": `package test
+type Test struct{}
+func (t *Test) hidden() {}`,
+		"conflict": `package test
+import ("context"; "flychain/rpc")
+type Test struct{}
+func (t *Test) Heads(ctx context.Context) (*rpc.Subscription, error) { return nil, nil }
+func (t *Test) SubscribeHeads() {}`,
+		"badNotify": `package test
+import ("context"; "flychain/rpc")
+type Test struct{}
+//rpcgen:notify *NoSuchType
+func (t *Test) Heads(ctx context.Context) (*rpc.Subscription, error) { return nil, nil }`,
+	}
+	for name, src := range tests {
+		bctx, typ, err := parseTestSource(name+".go", []byte(src), "Test")
+		if err != nil {
+			t.Fatalf("%s: error loading test source: %v", name, err)
+		}
+		if _, err := bctx.generate(typ, "test", "TestClient"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func checkTestOutput(inputFile string, output []byte) error {
+	in, err := parser.ParseFile(testFset, inputFile, nil, 0)
+	if err != nil {
+		return err
+	}
+	out, err := parser.ParseFile(testFset, "output.go", output, 0)
+	if err != nil {
+		return err
+	}
+	conf := types.Config{Importer: testImporter}
+	_, err = conf.Check("test", testFset, []*ast.File{in, out}, nil)
+	return err
+}
+
+func loadTestSource(file string, typeName string) (*buildContext, *types.Named, error) {
+	// 加载测试输入。
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseTestSource(file, content, typeName)
+}
+
+func parseTestSource(file string, content []byte, typeName string) (*buildContext, *types.Named, error) {
+	f, err := parser.ParseFile(testFset, file, content, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf := types.Config{Importer: testImporter}
+	files := []*ast.File{f}
+	pkg, err := conf.Check("test", testFset, files, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 找到测试类型。
+	bctx := newBuildContext(testPackageRPC, testFset, files)
+	typ, err := lookupType(pkg.Scope(), typeName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't find type %s: %v", typeName, err)
+	}
+	return bctx, typ, nil
+}
@@ -0,0 +1,150 @@
+// rpcgen 为注册到 rpc.Server 的服务类型生成类型化的客户端。
+//
+// 生成的客户端为服务的每个 RPC 方法和订阅提供一个方法，参数和结果的类型与
+// 服务方法相同。这样，重命名或修改服务方法会导致编译错误，而不是运行时错误。
+// 方法按照 rpc.Server.RegisterName 的规则被发现。
+//
+// 典型的用法是在服务类型所在的包中添加：
+//
+//	//go:generate go run flychain/rpc/rpcgen -type API -namespace eth -out gen_client.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const pathOfPackageRPC = "flychain/rpc"
+
+func main() {
+	var (
+		pkgdir    = flag.String("dir", ".", "input package")
+		output    = flag.String("out", "-", "output file (default is stdout)")
+		typename  = flag.String("type", "", "service type to generate a client for")
+		namespace = flag.String("namespace", "", "name the service is registered under")
+		client    = flag.String("client", "", "name of the generated client type (default <type>Client)")
+	)
+	flag.Parse()
+
+	cfg := Config{
+		Dir:       *pkgdir,
+		Type:      *typename,
+		Namespace: *namespace,
+		Client:    *client,
+	}
+	code, err := cfg.process()
+	if err != nil {
+		fatal(err)
+	}
+	if *output == "-" {
+		os.Stdout.Write(code)
+	} else if err := os.WriteFile(*output, code, 0600); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+	os.Exit(1)
+}
+
+type Config struct {
+	Dir       string // 输入包的目录
+	Type      string
+	Namespace string
+	Client    string
+}
+
+// process 生成 Go 代码。
+func (cfg *Config) process() (code []byte, err error) {
+	if cfg.Type == "" {
+		return nil, errors.New("-type is required")
+	}
+	if cfg.Namespace == "" {
+		return nil, errors.New("-namespace is required")
+	}
+	client := cfg.Client
+	if client == "" {
+		client = cfg.Type + "Client"
+	}
+
+	// 加载包。
+	pcfg := &packages.Config{
+		Mode:       packages.NeedName | packages.NeedTypes | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax,
+		Dir:        cfg.Dir,
+		BuildFlags: []string{"-tags", "norpcgen"},
+	}
+	ps, err := packages.Load(pcfg, pathOfPackageRPC, ".")
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("no Go package found in %s", cfg.Dir)
+	}
+	packages.PrintErrors(ps)
+
+	// 找到加载的包。如果输入包就是 rpc 包，两者相同。
+	var (
+		pkg        *types.Package
+		packageRPC *types.Package
+		fset       *token.FileSet
+		files      []*ast.File
+	)
+	for _, p := range ps {
+		if len(p.Errors) > 0 {
+			return nil, fmt.Errorf("package %s has errors", p.PkgPath)
+		}
+		if p.PkgPath == pathOfPackageRPC {
+			packageRPC = p.Types
+		}
+		if p.PkgPath != pathOfPackageRPC || len(ps) == 1 {
+			pkg, fset, files = p.Types, p.Fset, p.Syntax
+		}
+	}
+	bctx := newBuildContext(packageRPC, fset, files)
+
+	// 找到类型并生成代码。
+	typ, err := lookupType(pkg.Scope(), cfg.Type)
+	if err != nil {
+		return nil, fmt.Errorf("can't find %s in %s: %v", cfg.Type, pkg, err)
+	}
+	code, err = bctx.generate(typ, cfg.Namespace, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// 添加构建注释。
+	// 在这里添加是为了避免 gofmt 处理这些行。
+	var header bytes.Buffer
+	fmt.Fprint(&header, "// Code generated by rpcgen. DO NOT EDIT.\n\n")
+	fmt.Fprint(&header, "//go:build !norpcgen\n")
+	fmt.Fprint(&header, "// +build !norpcgen\n\n")
+	return append(header.Bytes(), code...), nil
+}
+
+func lookupType(scope *types.Scope, name string) (*types.Named, error) {
+	obj := scope.Lookup(name)
+	if obj == nil {
+		return nil, errors.New("no such identifier")
+	}
+	typ, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil, errors.New("not a type")
+	}
+	named, ok := typ.Type().(*types.Named)
+	if !ok {
+		return nil, errors.New("not a named type")
+	}
+	if _, ok := named.Underlying().(*types.Interface); ok {
+		return nil, errors.New("interface types can't be registered")
+	}
+	return named, nil
+}
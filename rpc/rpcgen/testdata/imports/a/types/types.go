@@ -0,0 +1,6 @@
+// Package types 和 ../../b/types 同名，用于测试生成的代码的导入。
+package types
+
+type Header struct {
+	Number uint64
+}
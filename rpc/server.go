@@ -2,10 +2,13 @@ package rpc
 
 import (
 	"context"
+	"flychain/common/mclock"
 	"flychain/log"
 	"io"
+	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const MetadataApi = "rpc"
@@ -29,17 +32,26 @@ type Server struct {
 	services serviceRegistry
 	idgen    func() ID
 
-	mutex sync.Mutex
-	codecs map[ServerCodec]struct{}
-	run   int32
+	mutex   sync.Mutex
+	codecs  map[ServerCodec]struct{}
+	run     int32
+	limiter *callLimiter
+
+	batchItemLimit     int
+	batchResponseLimit int
+	executionTimeout   time.Duration
+	interceptors       []Interceptor
+	metrics            *serverMetrics
 }
 
 // NewServer 创建一个没有注册处理程序的新服务器实例。
 func NewServer() *Server {
 	server := &Server{
-		idgen: randomIDGenerator(),
-		codecs: make(map[ServerCodec]struct{}),
-		run:   1,
+		idgen:   randomIDGenerator(),
+		codecs:  make(map[ServerCodec]struct{}),
+		run:     1,
+		limiter: newCallLimiter(mclock.System{}),
+		metrics: newServerMetrics(),
 	}
 	// 注册默认服务，提供有关 RPC 服务的元信息，例如
 	// 作为它提供的服务和方法。
@@ -56,13 +68,48 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 	return s.services.registerName(name, receiver)
 }
 
+// SetBatchLimits 设置批处理请求的限制：itemLimit 是批处理中的最大请求数，
+// responseSizeLimit 是批处理响应的最大字节数。零表示不限制。
+//
+// 应在服务器开始处理请求之前调用此方法。
+func (s *Server) SetBatchLimits(itemLimit, responseSizeLimit int) {
+	s.batchItemLimit = itemLimit
+	s.batchResponseLimit = responseSizeLimit
+}
+
+// SetExecutionTimeout 设置单个请求的最长执行时间，零表示不限制。
+// 超时后方法的上下文被取消，客户端会收到超时错误。对于批处理请求，
+// 客户端收到已完成调用的结果以及其余调用的超时错误。
+//
+// 通过 HTTP 提供服务时，HTTP 服务器的 WriteTimeout 也会限制执行时间，
+// 参见 HTTPTimeouts。
+//
+// 应在服务器开始处理请求之前调用此方法。
+func (s *Server) SetExecutionTimeout(timeout time.Duration) {
+	s.executionTimeout = timeout
+}
+
 // ServeCodec 从编解码器读取传入请求，调用适当的回调并写入
 // 使用给定的编解码器返回响应。它将阻塞直到编解码器关闭或
 // 服务器已停止。在任何一种情况下，编解码器都是关闭的。
 //
 // 请注意，不再支持编解码器选项。
-func (s *Server) ServerCodec(codec ServerCodec, options CodecOption) {
-	//defer codec.close()
+func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
+	s.serveCodec(codec, nil)
+}
+
+// serveCodec 为编解码器提供服务，只提供 modules 中的命名空间。
+func (s *Server) serveCodec(codec ServerCodec, modules moduleSet) {
+	defer codec.close()
+
+	if !s.trackCodec(codec) {
+		return
+	}
+	defer s.untrackCodec(codec)
+
+	c := initClient(codec, s.idgen, &s.services, s.handlerConfig(modules))
+	<-codec.closed()
+	c.Close()
 }
 
 func (s *Server) trackCodec(codec ServerCodec) bool {
@@ -83,16 +130,32 @@ func (s *Server) untrackCodec(codec ServerCodec) {
 	delete(s.codecs, codec)
 }
 
+// handlerConfig 返回服务器连接的处理程序使用的设置。modules 是
+// 连接可以使用的命名空间，nil 表示所有命名空间。
+func (s *Server) handlerConfig(modules moduleSet) *handlerConfig {
+	return &handlerConfig{
+		modules:              modules,
+		limiter:              s.limiter,
+		batchRequestLimit:    s.batchItemLimit,
+		batchResponseMaxSize: s.batchResponseLimit,
+		executionTimeout:     s.executionTimeout,
+		interceptors:         s.interceptors,
+		metrics:              s.metrics,
+	}
+}
+
 // serveSingleRequest 从给定的编解码器读取并处理单个 RPC 请求。这
 // 用于服务 HTTP 连接。不允许订阅和反向调用
 // 这种模式。
-func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
+func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec, modules moduleSet) {
 	// Don't serve if server is stopped.
 	if atomic.LoadInt32(&s.run) == 0 {
 		return
 	}
 
 	h := NewHandler(ctx, codec, s.idgen, &s.services)
+	h.configure(s.handlerConfig(modules))
+	h.peer = codec.peerInfo()
 	h.allowSubscribe = false
 	defer h.close(io.EOF, nil)
 
@@ -109,6 +172,8 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 	} else {
 		h.handleMsg(reqs[0])
 	}
+	// 等待调用完成后再关闭处理程序，关闭会取消调用的上下文。
+	h.CallWG.Wait()
 }
 
 // Stop 停止读取新的请求，等待 stopPendingRequestTimeout 允许挂起
@@ -132,14 +197,72 @@ type RPCService struct {
 	server *Server
 }
 
-// 模块返回 RPC 服务列表及其版本号
-func (s *RPCService) Modules() map[string]string {
+// 模块返回 RPC 服务列表及其版本号。只列出提供调用的入口可用的服务。
+func (s *RPCService) Modules(ctx context.Context) map[string]string {
 	s.server.services.mu.Lock()
 	defer s.server.services.mu.Unlock()
 
+	allowed := modulesFromContext(ctx)
 	modules := make(map[string]string)
 	for name := range s.server.services.services {
-		modules[name] = "1.0"
+		if allowed.allows(name) {
+			modules[name] = "1.0"
+		}
 	}
 	return modules
-}
\ No newline at end of file
+}
+
+// PeerInfo 包含有关 RPC 连接对端的信息。
+type PeerInfo struct {
+	// Transport 是协议名称，例如 "http"、"ipc"、"ws"。
+	Transport string
+
+	// RemoteAddr 是 RPC 连接对端的地址，如果可用的话。
+	RemoteAddr string
+
+	// HTTP 包含 HTTP 请求的信息。对于 WebSocket 连接，它描述握手请求。
+	// 其他传输的这些字段为空。
+	HTTP struct {
+		Version   string // 协议版本，例如 "HTTP/1.1"
+		UserAgent string // User-Agent 头部
+		Origin    string // Origin 头部
+		Host      string // Host 头部
+
+		// Header 是请求头部的副本，不包含 Authorization 头部。
+		Header http.Header
+	}
+
+	// Identity 是经过身份验证的调用者的标识，由身份验证处理程序设置，
+	// 参见 NewJWTHandler 和 WithAuthIdentity。未经身份验证时为空。
+	Identity string
+}
+
+type peerInfoContextKey struct{}
+
+// PeerInfoFromContext 返回发出当前调用的连接的信息。
+// 在 RPC 方法之外调用时，返回的 PeerInfo 为空。
+func PeerInfoFromContext(ctx context.Context) PeerInfo {
+	info, _ := ctx.Value(peerInfoContextKey{}).(PeerInfo)
+	return info
+}
+
+type authIdentityKey struct{}
+
+// WithAuthIdentity 返回携带调用者身份的上下文。身份验证处理程序在验证
+// HTTP 请求之后，用它包装请求的上下文，服务器会把身份放入 PeerInfo.Identity。
+func WithAuthIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, authIdentityKey{}, identity)
+}
+
+// newHTTPPeerInfo 返回 HTTP 请求的对端信息。
+func newHTTPPeerInfo(r *http.Request, transport string) PeerInfo {
+	info := PeerInfo{Transport: transport, RemoteAddr: r.RemoteAddr}
+	info.HTTP.Version = r.Proto
+	info.HTTP.UserAgent = r.UserAgent()
+	info.HTTP.Origin = r.Header.Get("Origin")
+	info.HTTP.Host = r.Host
+	info.HTTP.Header = r.Header.Clone()
+	info.HTTP.Header.Del("Authorization")
+	info.Identity, _ = r.Context().Value(authIdentityKey{}).(string)
+	return info
+}
@@ -0,0 +1,270 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerRegisterName(t *testing.T) {
+	server := NewServer()
+	service := new(testService)
+
+	if err := server.RegisterName("test", service); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(server.services.services) != 2 {
+		t.Fatalf("Expected 2 service entries, got %d", len(server.services.services))
+	}
+
+	svc, ok := server.services.services["test"]
+	if !ok {
+		t.Fatalf("Expected service calc to be registered")
+	}
+
+	wantCallbacks := 9
+	if len(svc.callbacks) != wantCallbacks {
+		t.Errorf("Expected %d callbacks for service 'service', got %d", wantCallbacks, len(svc.callbacks))
+	}
+}
+
+func TestServer(t *testing.T) {
+	files, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal("where'd my testdata go?")
+	}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		path := filepath.Join("testdata", f.Name())
+		name := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+		t.Run(name, func(t *testing.T) {
+			runTestScript(t, path)
+		})
+	}
+}
+
+func runTestScript(t *testing.T, file string) {
+	server := newTestServer()
+	server.SetBatchLimits(4, 100000)
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go server.ServeCodec(NewCodec(serverConn), 0)
+	readbuf := bufio.NewReader(clientConn)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case len(line) == 0 || strings.HasPrefix(line, "//"):
+			// 跳过注释和空行
+			continue
+		case strings.HasPrefix(line, "--> "):
+			t.Log(line)
+			// 写入连接
+			clientConn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if _, err := io.WriteString(clientConn, line[4:]+"\n"); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+		case strings.HasPrefix(line, "<-- "):
+			t.Log(line)
+			want := line[4:]
+			// 从连接读取一行并比较文本
+			clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			sent, err := readbuf.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read error: %v", err)
+			}
+			sent = strings.TrimRight(sent, "\r\n")
+			if sent != want {
+				t.Errorf("wrong line from server\ngot:  %s\nwant: %s", sent, want)
+			}
+		default:
+			panic("invalid line in test script: " + line)
+		}
+	}
+}
+
+func TestServerStop(t *testing.T) {
+	server := newTestServer()
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		server.ServeCodec(NewCodec(serverConn), 0)
+		close(done)
+	}()
+	server.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeCodec did not return after Stop")
+	}
+}
+
+func TestServerExecutionTimeout(t *testing.T) {
+	server := newTestServer()
+	service := &blockingService{started: make(chan struct{}), canceled: make(chan struct{})}
+	if err := server.RegisterName("block", service); err != nil {
+		t.Fatal(err)
+	}
+	server.SetExecutionTimeout(200 * time.Millisecond)
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	// 单个调用：客户端收到超时错误，方法的上下文被取消。
+	start := time.Now()
+	err := client.Call(nil, "block_block")
+	checkTimeoutError(t, err)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("timeout response took %v", d)
+	}
+	select {
+	case <-service.canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("method context was not canceled")
+	}
+
+	// 批处理：已完成的调用返回结果，其余调用返回超时错误。
+	service.started, service.canceled = make(chan struct{}), make(chan struct{})
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"x", 1, nil}, Result: new(echoResult)},
+		{Method: "block_block", Result: new(interface{})},
+		{Method: "test_echo", Args: []interface{}{"y", 2, nil}, Result: new(echoResult)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].Error != nil || batch[0].Result.(*echoResult).String != "x" {
+		t.Errorf("wrong result for first element: %+v, err %v", batch[0].Result, batch[0].Error)
+	}
+	for _, elem := range batch[1:] {
+		checkTimeoutError(t, elem.Error)
+	}
+}
+
+func checkTimeoutError(t *testing.T, err error) {
+	t.Helper()
+	var rpcErr Error
+	if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != errcodeTimeout || rpcErr.Error() != errMsgTimeout {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+type peerInfoService struct{}
+
+func (peerInfoService) Get(ctx context.Context) PeerInfo {
+	return PeerInfoFromContext(ctx)
+}
+
+func TestServerPeerInfo(t *testing.T) {
+	server := newTestServer()
+	if err := server.RegisterName("peer", peerInfoService{}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	client := DialInProc(server)
+	defer client.Close()
+	var info PeerInfo
+	if err := client.Call(&info, "peer_get"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Transport != "inproc" || info.HTTP.UserAgent != "" || info.Identity != "" {
+		t.Errorf("wrong peer info for in-process connection: %+v", info)
+	}
+
+	// ServeListener 从监听器的网络得出传输协议名称。
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.ServeListener(l)
+	tcpClient, err := newClient(context.Background(), func(ctx context.Context) (ServerCodec, error) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		return NewCodec(conn), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpClient.Close()
+	if err := tcpClient.Call(&info, "peer_get"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Transport != "tcp" {
+		t.Errorf("wrong peer info for TCP: %+v", info)
+	}
+
+	// HTTP，通过带有 id 声明的 JWT 令牌进行身份验证。
+	httpsrv := httptest.NewServer(newTestJWTHandler(t, server))
+	defer httpsrv.Close()
+	auth := func(h http.Header) error {
+		claims := base64.RawURLEncoding.EncodeToString([]byte(`{"iat":` + strconv.FormatInt(time.Now().Unix(), 10) + `,"id":"node-1"}`))
+		input := jwtHS256Header + "." + claims
+		h.Set("Authorization", "Bearer "+input+"."+base64.RawURLEncoding.EncodeToString(signJWT(input, testJWTSecret)))
+		return nil
+	}
+	httpClient, err := DialHTTPWithAuth(httpsrv.URL, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpClient.Close()
+	httpClient.SetHeader("user-agent", "peer-test/1.0")
+	httpClient.SetHeader("origin", "https://wallet.example")
+	if err := httpClient.Call(&info, "peer_get"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Transport != "http" || info.RemoteAddr == "" {
+		t.Errorf("wrong transport info for HTTP: %+v", info)
+	}
+	if info.HTTP.UserAgent != "peer-test/1.0" || info.HTTP.Origin != "https://wallet.example" || info.HTTP.Version != "HTTP/1.1" {
+		t.Errorf("wrong HTTP info: %+v", info.HTTP)
+	}
+	if info.HTTP.Host != strings.TrimPrefix(httpsrv.URL, "http://") {
+		t.Errorf("wrong host %q", info.HTTP.Host)
+	}
+	if info.HTTP.Header.Get("content-type") != contentType || info.HTTP.Header.Get("authorization") != "" {
+		t.Errorf("wrong HTTP header: %v", info.HTTP.Header)
+	}
+	if info.Identity != "node-1" {
+		t.Errorf("wrong identity %q", info.Identity)
+	}
+
+	// WebSocket 连接使用握手请求的信息。
+	wssrv := httptest.NewServer(newTestJWTHandler(t, server.WebsocketHandler([]string{"*"})))
+	defer wssrv.Close()
+	wsClient, err := DialWebsocketWithAuth(context.Background(), "ws:"+strings.TrimPrefix(wssrv.URL, "http:"), "https://dapp.example", newTestJWTAuth(t, testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wsClient.Close()
+	if err := wsClient.Call(&info, "peer_get"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Transport != "ws" || info.RemoteAddr == "" || info.HTTP.Origin != "https://dapp.example" || info.Identity != "jwt" {
+		t.Errorf("wrong peer info for websocket: %+v", info)
+	}
+}
@@ -58,8 +58,8 @@ func (r *serviceRegistry) registerName(name string, rcvr interface{}) error {
 	svc, ok := r.services[name]
 	if !ok {
 		svc = service{
-			name: name,
-			callbacks: make(map[string]*callback),
+			name:          name,
+			callbacks:     make(map[string]*callback),
 			subscriptions: make(map[string]*callback),
 		}
 		r.services[name] = svc
@@ -71,7 +71,7 @@ func (r *serviceRegistry) registerName(name string, rcvr interface{}) error {
 			svc.callbacks[name] = cb
 		}
 	}
-	return nil 
+	return nil
 }
 
 // callback 返回对应给定 RPC 方法名的回调。
@@ -83,7 +83,15 @@ func (r *serviceRegistry) callback(method string) *callback {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	return r.services[elem[0]].callbacks[elem[1]]
-} 
+}
+
+// hasService 报告给定名称的服务是否已注册。
+func (r *serviceRegistry) hasService(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.services[name]
+	return ok
+}
 
 // 订阅返回给定服务中的订阅回调。
 func (r *serviceRegistry) subscription(service, name string) *callback {
@@ -172,6 +180,7 @@ func (c *callback) call(ctx context.Context, method string, args []reflect.Value
 	if c.hasCtx {
 		fullargs = append(fullargs, reflect.ValueOf(ctx))
 	}
+	fullargs = append(fullargs, args...)
 
 	// 在运行回调时捕获 panic。
 	defer func() {
@@ -186,7 +195,7 @@ func (c *callback) call(ctx context.Context, method string, args []reflect.Value
 	// Run the callback
 	results := c.fn.Call(fullargs)
 	if len(results) == 0 {
-		return nil, nil 
+		return nil, nil
 	}
 	if c.errPos >= 0 && !results[c.errPos].IsNil() {
 		// 方法返回了非零错误值。
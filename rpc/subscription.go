@@ -67,7 +67,10 @@ func encodeID(b []byte) ID {
 type notifierKey struct{}
 
 // NotifierFromContext 返回存储在 ctx 中的 Notifier 值（如果有）。
-func NotifierFromContext(ctx context.Context)
+func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
+	n, ok := ctx.Value(notifierKey{}).(*Notifier)
+	return n, ok
+}
 
 // 通知程序绑定到支持订阅的 RPC 连接。
 // 服务器回调使用通知程序发送通知。
@@ -125,7 +128,7 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 // Closed 返回一个在 RPC 连接关闭时关闭的通道。
 // 弃用：使用订阅错误通道
 func (n *Notifier) Closed() <-chan interface{} {
-	return n.h.conn.closed
+	return n.h.conn.closed()
 }
 
 // takeSubscription 返回订阅（如果已经创建）。没有订阅可以
@@ -149,6 +152,7 @@ func (n *Notifier) activate() error {
 			return err
 		}
 	}
+	n.buffer = nil
 	n.activated = true
 	return nil
 }
@@ -159,8 +163,8 @@ func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
 
 	msg := &jsonrpcMessage{
 		Version: vsn,
-		Method: n.namespace + notificationMethodSuffix,
-		Params: params,
+		Method:  n.namespace + notificationMethodSuffix,
+		Params:  params,
 	}
 	return n.h.conn.writeJSON(ctx, msg, false)
 }
@@ -220,7 +224,7 @@ func newClientSubscription(c *Client, namespace string, channel reflect.Value) *
 		quit:        make(chan error),
 		forwardDone: make(chan struct{}),
 		unsubDone:   make(chan struct{}),
-		err:         make(chan error),
+		err:         make(chan error, 1),
 	}
 	return sub
 }
@@ -352,5 +356,7 @@ func (sub *ClientSubscription) unmarshal(result json.RawMessage) (interface{}, e
 
 func (sub *ClientSubscription) requestUnsubscribe() error {
 	var result interface{}
-	return sub.client.Call()
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+	return sub.client.CallContext(ctx, &result, sub.namespace+unsubscribeMethodSuffix, sub.subid)
 }
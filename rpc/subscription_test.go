@@ -0,0 +1,290 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewID(t *testing.T) {
+	hexchars := "0123456789ABCDEFabcdef"
+	for i := 0; i < 100; i++ {
+		id := string(NewID())
+		if !strings.HasPrefix(id, "0x") {
+			t.Fatalf("invalid ID prefix, want '0x...', got %s", id)
+		}
+
+		id = id[2:]
+		if len(id) == 0 || len(id) > 32 {
+			t.Fatalf("invalid ID length, want len(id) > 0 && len(id) <= 32), got %d", len(id))
+		}
+
+		for i := 0; i < len(id); i++ {
+			if strings.IndexByte(hexchars, id[i]) == -1 {
+				t.Fatalf("unexpected byte, want any valid hex char, got %c", id[i])
+			}
+		}
+	}
+}
+
+// 此测试检查订阅通知只在订阅 ID 发送之后到达，
+// 并且在激活之前缓冲的通知不会丢失。
+func TestSubscriptions(t *testing.T) {
+	var (
+		subCount          = 10
+		notificationCount = 5
+
+		server                 = newTestServer()
+		clientConn, serverConn = net.Pipe()
+		out                    = json.NewEncoder(clientConn)
+		in                     = json.NewDecoder(clientConn)
+		successes              = make(chan subConfirmation)
+		notifications          = make(chan subscriptionResult)
+		errors                 = make(chan error, subCount*notificationCount+1)
+	)
+	defer server.Stop()
+
+	// 为服务器创建连接。
+	go server.ServeCodec(NewCodec(serverConn), 0)
+	defer clientConn.Close()
+
+	// 等待消息并将其写入给定的通道。
+	go waitForMessages(in, successes, notifications, errors)
+
+	// 创建订阅。
+	for i := 0; i < subCount; i++ {
+		request := map[string]interface{}{
+			"id":      i,
+			"method":  "nftest_subscribe",
+			"jsonrpc": "2.0",
+			"params":  []interface{}{"someSubscription", notificationCount, i},
+		}
+		if err := out.Encode(&request); err != nil {
+			t.Fatalf("Could not create subscription: %v", err)
+		}
+	}
+
+	timeout := time.After(30 * time.Second)
+	subids := make(map[string]int, subCount)
+	count := make(map[string]int, subCount)
+	allReceived := func() bool {
+		done := len(count) == subCount
+		for _, c := range count {
+			if c < notificationCount {
+				done = false
+			}
+		}
+		return done
+	}
+	for !allReceived() {
+		select {
+		case confirmation := <-successes: // 订阅创建成功
+			subids[confirmation.subid] = int(confirmation.reqid)
+		case notification := <-notifications:
+			reqid, ok := subids[notification.ID]
+			if !ok {
+				t.Fatalf("notification for subscription %s arrived before its ID", notification.ID)
+			}
+			var val int
+			if err := json.Unmarshal(notification.Result, &val); err != nil {
+				t.Fatal(err)
+			}
+			if want := reqid + count[notification.ID]; val != want {
+				t.Fatalf("wrong notification value %d for subscription %s, want %d", val, notification.ID, want)
+			}
+			count[notification.ID]++
+		case err := <-errors:
+			t.Fatal(err)
+		case <-timeout:
+			for id, c := range count {
+				t.Errorf("subscription %s got %d notifications, want %d", id, c, notificationCount)
+			}
+			t.Fatal("timed out")
+		}
+	}
+}
+
+// 此测试检查服务器端订阅在客户端取消订阅后被清理。
+func TestServerUnsubscribe(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p2.Close()
+
+	// 启动服务器。
+	server := newTestServer()
+	service := &notificationTestService{unsubscribed: make(chan string, 1)}
+	server.RegisterName("nftest2", service)
+	go server.ServeCodec(NewCodec(p1), 0)
+	defer server.Stop()
+
+	// 订阅。
+	p2.SetDeadline(time.Now().Add(10 * time.Second))
+	p2.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"nftest2_subscribe","params":["someSubscription",0,10]}`))
+
+	// 读取响应。
+	var (
+		dec  = json.NewDecoder(p2)
+		resp jsonrpcMessage
+	)
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatal("read error:", err)
+	}
+	var subid string
+	if err := json.Unmarshal(resp.Result, &subid); err != nil {
+		t.Fatalf("invalid subscription response %s: %v", resp.String(), err)
+	}
+
+	// 取消订阅并检查服务是否收到通知。
+	p2.Write([]byte(`{"jsonrpc":"2.0","id":2,"method":"nftest2_unsubscribe","params":["` + subid + `"]}`))
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatal("read error:", err)
+	}
+	if string(resp.Result) != "true" {
+		t.Fatalf("wrong unsubscribe result %s", resp.String())
+	}
+	select {
+	case id := <-service.unsubscribed:
+		if id != subid {
+			t.Errorf("wrong subscription ID unsubscribed: got %q, want %q", id, subid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not closed after unsubscribe")
+	}
+
+	// 第二次取消订阅应该失败。
+	p2.Write([]byte(`{"jsonrpc":"2.0","id":3,"method":"nftest2_unsubscribe","params":["` + subid + `"]}`))
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatal("read error:", err)
+	}
+	if resp.Error == nil || resp.Error.Message != ErrSubscriptionNotFound.Error() {
+		t.Fatalf("wrong response for second unsubscribe: %s", resp.String())
+	}
+}
+
+// 此测试检查服务器端订阅在连接关闭时被清理。
+func TestServerSubscriptionCloseOnDisconnect(t *testing.T) {
+	p1, p2 := net.Pipe()
+
+	server := newTestServer()
+	service := &notificationTestService{unsubscribed: make(chan string, 1)}
+	server.RegisterName("nftest2", service)
+	go server.ServeCodec(NewCodec(p1), 0)
+	defer server.Stop()
+
+	p2.SetDeadline(time.Now().Add(10 * time.Second))
+	p2.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"nftest2_subscribe","params":["someSubscription",0,10]}`))
+	var resp jsonrpcMessage
+	if err := json.NewDecoder(p2).Decode(&resp); err != nil {
+		t.Fatal("read error:", err)
+	}
+	p2.Close()
+
+	select {
+	case <-service.unsubscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not closed after disconnect")
+	}
+}
+
+func TestSubscribeInvalidName(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	_, err := client.Subscribe(context.Background(), "nftest", make(chan int), "noSuchSubscription")
+	if err == nil || err.Error() != (&subscriptionNotFoundError{"nftest", "noSuchSubscription"}).Error() {
+		t.Fatalf("wrong error %v", err)
+	}
+	_, err = client.Subscribe(context.Background(), "nftest", make(chan int))
+	if err == nil {
+		t.Fatal("no error for subscribe without name")
+	}
+}
+
+// 此测试使用 Client.Subscribe 对真实的服务器进行端到端测试。
+func TestClientSubscribeServer(t *testing.T) {
+	server := newTestServer()
+	service := &notificationTestService{unsubscribed: make(chan string, 1)}
+	server.RegisterName("nftest2", service)
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	const count = 10
+	ch := make(chan int)
+	sub, err := client.Subscribe(context.Background(), "nftest2", ch, "someSubscription", count, 0)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < count; i++ {
+		select {
+		case v := <-ch:
+			if v != i {
+				t.Fatalf("wrong value %d, want %d", v, i)
+			}
+		case err := <-sub.Err():
+			t.Fatal("subscription error:", err)
+		case <-timeout:
+			t.Fatal("timed out waiting for notification", i)
+		}
+	}
+	sub.Unsubscribe()
+	select {
+	case <-service.unsubscribed:
+	case <-timeout:
+		t.Fatal("server subscription not closed after Unsubscribe")
+	}
+}
+
+// subConfirmation 是对订阅请求的成功响应。
+type subConfirmation struct {
+	reqid int
+	subid string
+}
+
+// waitForMessages 读取 RPC 消息，并把订阅确认和通知分别发送到对应的通道。
+func waitForMessages(in *json.Decoder, successes chan subConfirmation, notifications chan subscriptionResult, errors chan error) {
+	for {
+		resp, notification, err := readAndValidateMessage(in)
+		if err != nil {
+			errors <- err
+			return
+		} else if resp != nil {
+			successes <- *resp
+		} else {
+			notifications <- *notification
+		}
+	}
+}
+
+func readAndValidateMessage(in *json.Decoder) (*subConfirmation, *subscriptionResult, error) {
+	var msg jsonrpcMessage
+	if err := in.Decode(&msg); err != nil {
+		return nil, nil, fmt.Errorf("decode error: %v", err)
+	}
+	switch {
+	case msg.isNotification():
+		var res subscriptionResult
+		if err := json.Unmarshal(msg.Params, &res); err != nil {
+			return nil, nil, fmt.Errorf("invalid subscription result: %v", err)
+		}
+		return nil, &res, nil
+	case msg.isResponse():
+		var c subConfirmation
+		if msg.Error != nil {
+			return nil, nil, msg.Error
+		} else if err := json.Unmarshal(msg.Result, &c.subid); err != nil {
+			return nil, nil, fmt.Errorf("invalid response: %v", err)
+		} else {
+			json.Unmarshal(msg.ID, &c.reqid)
+			return &c, nil, nil
+		}
+	default:
+		return nil, nil, fmt.Errorf("unrecognized message: %v", msg)
+	}
+}
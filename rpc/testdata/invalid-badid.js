@@ -0,0 +1,4 @@
+// 此测试发送一个 ID 无效的请求。
+
+--> {"jsonrpc": "2.0", "id": {}, "method": "test_foo"}
+<-- {"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}
@@ -0,0 +1,4 @@
+// 此测试发送一条只有 ID 的无效消息。
+
+--> {"jsonrpc":"2.0","id":1}
+<-- {"jsonrpc":"2.0","id":1,"error":{"code":-32600,"message":"invalid request"}}
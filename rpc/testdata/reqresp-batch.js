@@ -0,0 +1,9 @@
+// 此测试在一个批次中调用 test_echo 方法两次。
+
+--> [{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",1]},{"jsonrpc":"2.0","id":2,"method":"test_echo","params":["x",2]}]
+<-- [{"jsonrpc":"2.0","id":1,"result":{"String":"x","Int":1,"Args":null}},{"jsonrpc":"2.0","id":2,"result":{"String":"x","Int":2,"Args":null}}]
+
+// 批次中的通知不会产生响应。
+
+--> [{"jsonrpc":"2.0","method":"test_echo","params":["x",1]},{"jsonrpc":"2.0","id":3,"method":"test_echo","params":["x",3]}]
+<-- [{"jsonrpc":"2.0","id":3,"result":{"String":"x","Int":3,"Args":null}}]
@@ -0,0 +1,7 @@
+// 此测试检查服务返回的错误和崩溃的处理。
+
+--> {"jsonrpc":"2.0","id":1,"method":"test_returnError","params":[]}
+<-- {"jsonrpc":"2.0","id":1,"error":{"code":444,"message":"testError","data":"testError data"}}
+
+--> {"jsonrpc":"2.0","id":2,"method":"test_panic","params":[]}
+<-- {"jsonrpc":"2.0","id":2,"error":{"code":-32603,"message":"method handler crashed"}}
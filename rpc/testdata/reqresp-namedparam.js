@@ -0,0 +1,4 @@
+// 此测试使用命名参数调用方法。这是不支持的。
+
+--> {"jsonrpc":"2.0","id":2,"method":"test_echo","params":{"int":23}}
+<-- {"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"non-array args"}}
@@ -0,0 +1,4 @@
+// 此测试调用一个没有参数和返回值的方法。
+
+--> {"jsonrpc":"2.0","id":3,"method":"test_noArgsRets"}
+<-- {"jsonrpc":"2.0","id":3,"result":null}
@@ -0,0 +1,4 @@
+// 此测试调用一个不存在的方法。
+
+--> {"jsonrpc":"2.0","id":1,"method":"invalid_method","params":[2,3]}
+<-- {"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"the method invalid_method does not exist/is not available"}}
@@ -0,0 +1,4 @@
+// 此测试调用一个参数为空的方法。
+
+--> {"jsonrpc":"2.0","id":3,"method":"test_noArgsRets","params":[]}
+<-- {"jsonrpc":"2.0","id":3,"result":null}
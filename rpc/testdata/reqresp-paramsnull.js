@@ -0,0 +1,4 @@
+// 此测试调用一个 params 为 null 的方法。
+
+--> {"jsonrpc":"2.0","id":3,"method":"test_noArgsRets","params":null}
+<-- {"jsonrpc":"2.0","id":3,"result":null}
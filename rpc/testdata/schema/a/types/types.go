@@ -0,0 +1,6 @@
+// Package types 和 ../../b/types 包含同名的类型，用于测试 OpenRPC 文档的生成。
+package types
+
+type Header struct {
+	Number uint64
+}
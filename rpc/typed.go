@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	errBatchNotSent     = errors.New("batch has not been sent")
+	errBatchAlreadySent = errors.New("batch has already been sent")
+)
+
+// CallTyped 调用给定的方法并把结果解码为 T。
+//
+// 结果的约定与 Client.CallContext 相同：如果服务器返回 JSON null，结果是
+// T 的零值，错误为 nil。需要区分 null 和零值时，请使用指针类型作为 T，
+// null 会被解码为 nil 指针。如果响应既没有结果也没有错误，则返回 ErrNoResult。
+// 出错时总是返回 T 的零值。
+func CallTyped[T any](ctx context.Context, c *Client, method string, args ...interface{}) (T, error) {
+	var result T
+	if err := c.CallContext(ctx, &result, method, args...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// Batch 收集要作为一个批次发送的调用。使用 BatchAdd 添加调用，每次添加
+// 返回一个 Future，在 Send 返回之后可以从中获得调用的结果。
+//
+// Batch 不能被并发使用。
+type Batch struct {
+	elems   []BatchElem
+	sent    bool
+	sendErr error
+}
+
+// NewBatch 创建一个空的批次。
+func NewBatch() *Batch {
+	return new(Batch)
+}
+
+// Future 是批次中单个调用的结果。
+type Future[T any] struct {
+	batch  *Batch
+	index  int
+	result T
+}
+
+// BatchAdd 向批次中添加一个调用，其结果将被解码为 T。
+// 在批次发送之后不能再添加调用，此时返回的 Future 报告错误。
+func BatchAdd[T any](b *Batch, method string, args ...interface{}) *Future[T] {
+	f := &Future[T]{batch: b, index: -1}
+	if b.sent {
+		return f
+	}
+	f.index = len(b.elems)
+	b.elems = append(b.elems, BatchElem{Method: method, Args: args, Result: &f.result})
+	return f
+}
+
+// Len 返回批次中的调用数量。
+func (b *Batch) Len() int {
+	return len(b.elems)
+}
+
+// Send 将批次中的所有调用作为一个批处理请求发送，并等待所有响应。
+// 与 Client.BatchCallContext 一样，它只返回 I/O 错误，单个调用的错误
+// 通过相应 Future 的 Result 报告。批次只能发送一次。
+func (b *Batch) Send(ctx context.Context, c *Client) error {
+	if b.sent {
+		return errBatchAlreadySent
+	}
+	b.sent = true
+	if len(b.elems) == 0 {
+		return nil
+	}
+	b.sendErr = c.BatchCallContext(ctx, b.elems)
+	return b.sendErr
+}
+
+// Result 返回调用的结果。null 结果和 ErrNoResult 的约定与 CallTyped 相同。
+// 如果批次还没有发送，或者发送失败，则返回相应的错误。
+func (f *Future[T]) Result() (T, error) {
+	var zero T
+	switch {
+	case f.index < 0:
+		return zero, errBatchAlreadySent
+	case !f.batch.sent:
+		return zero, errBatchNotSent
+	case f.batch.sendErr != nil:
+		return zero, f.batch.sendErr
+	}
+	if err := f.batch.elems[f.index].Error; err != nil {
+		return zero, err
+	}
+	return f.result, nil
+}
@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCallTyped(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+	ctx := context.Background()
+
+	res, err := CallTyped[echoResult](ctx, client, "test_echo", "hello", 10, &echoArgs{"world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (echoResult{"hello", 10, &echoArgs{"world"}}); !reflect.DeepEqual(res, want) {
+		t.Errorf("wrong result %#v, want %#v", res, want)
+	}
+
+	// null 结果被解码为零值，指针类型可以区分 null。
+	str, err := CallTyped[string](ctx, client, "test_noArgsRets")
+	if err != nil || str != "" {
+		t.Errorf("null result: got %q, %v", str, err)
+	}
+	ptr, err := CallTyped[*string](ctx, client, "test_noArgsRets")
+	if err != nil || ptr != nil {
+		t.Errorf("null result: got %v, %v", ptr, err)
+	}
+
+	// 出错时返回零值。
+	n, err := CallTyped[int](ctx, client, "test_repeat", "x", 2)
+	if err == nil || n != 0 {
+		t.Errorf("invalid result type: got %d, %v", n, err)
+	}
+	if _, err := CallTyped[string](ctx, client, "test_returnError"); err == nil {
+		t.Error("expected error from test_returnError")
+	}
+}
+
+func TestCallTypedNoResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg jsonrpcMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		w.Header().Set("content-type", contentType)
+		io.WriteString(w, `{"jsonrpc":"2.0","id":`+string(msg.ID)+"}")
+	}))
+	defer srv.Close()
+
+	client, err := DialHTTP(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := CallTyped[*string](context.Background(), client, "test_noResult"); err != ErrNoResult {
+		t.Fatalf("wrong error %v, want %v", err, ErrNoResult)
+	}
+}
+
+func TestBatchFutures(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	b := NewBatch()
+	repeat := BatchAdd[string](b, "test_repeat", "a", 3)
+	echo := BatchAdd[*echoResult](b, "test_echo", "x", 1, nil)
+	null := BatchAdd[*string](b, "test_noArgsRets")
+	fail := BatchAdd[string](b, "test_returnError")
+	missing := BatchAdd[string](b, "no_such_method")
+
+	if _, err := repeat.Result(); err != errBatchNotSent {
+		t.Fatalf("wrong error before send: %v", err)
+	}
+	if b.Len() != 5 {
+		t.Fatalf("wrong batch length %d", b.Len())
+	}
+	if err := b.Send(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := repeat.Result(); err != nil || s != "aaa" {
+		t.Errorf("repeat: got %q, %v", s, err)
+	}
+	if r, err := echo.Result(); err != nil || r == nil || r.String != "x" || r.Int != 1 {
+		t.Errorf("echo: got %v, %v", r, err)
+	}
+	if p, err := null.Result(); err != nil || p != nil {
+		t.Errorf("null: got %v, %v", p, err)
+	}
+	if _, err := fail.Result(); err == nil {
+		t.Error("returnError: expected error")
+	}
+	if _, err := missing.Result(); err == nil {
+		t.Error("missing method: expected error")
+	}
+
+	// 批次只能发送一次。
+	if err := b.Send(context.Background(), client); err != errBatchAlreadySent {
+		t.Errorf("wrong error for second send: %v", err)
+	}
+	late := BatchAdd[string](b, "test_repeat", "b", 1)
+	if _, err := late.Result(); err != errBatchAlreadySent {
+		t.Errorf("wrong error for call added after send: %v", err)
+	}
+}
+
+func TestBatchFuturesSendError(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	client.Close()
+
+	b := NewBatch()
+	f := BatchAdd[string](b, "test_repeat", "a", 1)
+	err := b.Send(context.Background(), client)
+	if err == nil {
+		t.Fatal("expected error sending on closed client")
+	}
+	if _, ferr := f.Result(); ferr != err {
+		t.Errorf("wrong future error %v, want %v", ferr, err)
+	}
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// vhostHandler 是一个 http.Handler，它根据允许的虚拟主机列表验证请求的
+// Host 头部。这可以防止 DNS 重绑定攻击：恶意网页不能通过把自己的域名
+// 解析到本地地址来调用节点。
+type vhostHandler struct {
+	vhosts map[string]struct{}
+	next   http.Handler
+}
+
+// NewVHostHandler 创建一个 http.Handler，它只把 Host 头部在 vhosts 中的
+// 请求交给 next。'*' 允许所有主机。Host 为 IP 地址的请求总是被允许的，
+// 因为 DNS 重绑定需要域名。其他请求得到 403 响应。
+func NewVHostHandler(vhosts []string, next http.Handler) http.Handler {
+	h := &vhostHandler{vhosts: make(map[string]struct{}), next: next}
+	for _, host := range vhosts {
+		h.vhosts[strings.ToLower(strings.TrimSpace(host))] = struct{}{}
+	}
+	return h
+}
+
+// ServeHTTP 实现 http.Handler。
+func (h *vhostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 浏览器总是设置 Host 头部，所以没有 Host 的请求可以继续处理。
+	if r.Host == "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		// 没有端口。
+		host = r.Host
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if net.ParseIP(host) != nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if _, ok := h.vhosts["*"]; ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if _, ok := h.vhosts[strings.ToLower(host)]; ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "invalid host specified", http.StatusForbidden)
+}
+
+// NewHTTPHandlerStack 用 CORS、虚拟主机检查以及可选的 JWT 身份验证包装 srv。
+// srv 通常是 Server 或者 Endpoint。如果 jwtSecret 为空，则不检查令牌，
+// 否则它必须是 32 字节。
+func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string, jwtSecret []byte) (http.Handler, error) {
+	handler := srv
+	if len(jwtSecret) != 0 {
+		var err error
+		if handler, err = NewJWTHandler(jwtSecret, handler); err != nil {
+			return nil, err
+		}
+	}
+	handler = NewCORSHandler(cors, handler)
+	return NewVHostHandler(vhosts, handler), nil
+}
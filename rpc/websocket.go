@@ -0,0 +1,327 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"flychain/internal/websocket"
+	"flychain/log"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	wsReadBuffer       = 1024
+	wsPingInterval     = 30 * time.Second
+	wsPingWriteTimeout = 5 * time.Second
+	wsPongTimeout      = 30 * time.Second
+	wsMessageSizeLimit = 15 * 1024 * 1024
+	wsCloseTimeout     = time.Second
+)
+
+// WebsocketHandler 返回一个为 WebSocket 连接提供 JSON-RPC 服务的处理程序。
+//
+// allowedOrigins 是允许的源 URL 列表。要允许任何源的连接，请传入 "*"。
+func (s *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
+	return s.websocketHandler(allowedOrigins, nil)
+}
+
+func (s *Server) websocketHandler(allowedOrigins []string, modules moduleSet) http.Handler {
+	var upgrader = websocket.Upgrader{
+		ReadBufferSize: wsReadBuffer,
+		CheckOrigin:    wsHandshakeValidator(allowedOrigins),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Debug("WebSocket upgrade failed", "err", err)
+			return
+		}
+		codec := newWebsocketCodec(conn, r)
+		s.serveCodec(codec, modules)
+	})
+}
+
+// wsHandshakeValidator 返回一个在 WebSocket 升级过程中验证源的处理程序。
+// 当 '*' 被指定为允许的源时，接受所有连接。
+func wsHandshakeValidator(allowedOrigins []string) func(*http.Request) bool {
+	origins := make(map[string]struct{})
+	allowAllOrigins := false
+
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAllOrigins = true
+		}
+		if origin != "" {
+			origins[strings.ToLower(origin)] = struct{}{}
+		}
+	}
+	// 如果没有指定 allowedOrigins，则允许 localhost。
+	if len(origins) == 0 {
+		origins["http://localhost"] = struct{}{}
+		if hostname, err := os.Hostname(); err == nil {
+			origins["http://"+strings.ToLower(hostname)] = struct{}{}
+		}
+	}
+	log.Debug(fmt.Sprintf("Allowed origin(s) for WS RPC interface %v", allowedOrigins))
+
+	f := func(req *http.Request) bool {
+		// 如果没有 Origin 头，则跳过源验证。源检查是为了防止基于浏览器的攻击，
+		// 而浏览器总是会设置 Origin。非浏览器软件可以在 Origin 中填入任何内容，
+		// 检查它并不能提供额外的安全性。
+		if _, ok := req.Header["Origin"]; !ok {
+			return true
+		}
+		// 根据允许列表验证源。
+		origin := strings.ToLower(req.Header.Get("Origin"))
+		if allowAllOrigins || originIsAllowed(origins, origin) {
+			return true
+		}
+		log.Warn("Rejected WebSocket connection", "origin", origin)
+		return false
+	}
+
+	return f
+}
+
+type wsHandshakeError struct {
+	err    error
+	status string
+}
+
+func (e wsHandshakeError) Error() string {
+	s := e.err.Error()
+	if e.status != "" {
+		s += " (HTTP status " + e.status + ")"
+	}
+	return s
+}
+
+func originIsAllowed(allowedOrigins map[string]struct{}, browserOrigin string) bool {
+	for origin := range allowedOrigins {
+		if ruleAllowsOrigin(origin, browserOrigin) {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleAllowsOrigin(allowedOrigin string, browserOrigin string) bool {
+	var (
+		allowedScheme, allowedHostname, allowedPort string
+		browserScheme, browserHostname, browserPort string
+		err                                         error
+	)
+	allowedScheme, allowedHostname, allowedPort, err = parseOriginURL(allowedOrigin)
+	if err != nil {
+		log.Warn("Error parsing allowed origin specification", "spec", allowedOrigin, "error", err)
+		return false
+	}
+	browserScheme, browserHostname, browserPort, err = parseOriginURL(browserOrigin)
+	if err != nil {
+		log.Warn("Error parsing browser 'Origin' field", "Origin", browserOrigin, "error", err)
+		return false
+	}
+	if allowedScheme != "" && allowedScheme != browserScheme {
+		return false
+	}
+	if allowedHostname != "" && allowedHostname != browserHostname {
+		return false
+	}
+	if allowedPort != "" && allowedPort != browserPort {
+		return false
+	}
+	return true
+}
+
+func parseOriginURL(origin string) (string, string, string, error) {
+	parsedURL, err := url.Parse(strings.ToLower(origin))
+	if err != nil {
+		return "", "", "", err
+	}
+	var scheme, hostname, port string
+	if strings.Contains(origin, "://") {
+		scheme = parsedURL.Scheme
+		hostname = parsedURL.Hostname()
+		port = parsedURL.Port()
+	} else {
+		scheme = ""
+		hostname = parsedURL.Scheme
+		port = parsedURL.Opaque
+		if hostname == "" {
+			hostname = origin
+		}
+	}
+	return scheme, hostname, port, nil
+}
+
+// DialWebsocketWithDialer 创建一个新的 RPC 客户端，它通过 WebSocket 与监听在
+// 给定端点上的 JSON-RPC 服务器通信，使用给定的拨号器。
+//
+// 上下文用于建立初始连接。它不影响与客户端的后续交互。
+func DialWebsocketWithDialer(ctx context.Context, endpoint, origin string, dialer websocket.Dialer) (*Client, error) {
+	return dialWebsocket(ctx, endpoint, origin, dialer, nil)
+}
+
+// DialWebsocketWithAuth 创建一个新的 RPC 客户端，它通过 WebSocket 与 JSON-RPC
+// 服务器通信。每次（重新）建立连接时，都会调用 auth 设置握手请求的身份验证头。
+func DialWebsocketWithAuth(ctx context.Context, endpoint, origin string, auth HTTPAuth) (*Client, error) {
+	dialer := websocket.Dialer{
+		ReadBufferSize: wsReadBuffer,
+	}
+	return dialWebsocket(ctx, endpoint, origin, dialer, auth)
+}
+
+func dialWebsocket(ctx context.Context, endpoint, origin string, dialer websocket.Dialer, auth HTTPAuth) (*Client, error) {
+	endpoint, header, err := wsClientHeaders(endpoint, origin)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(ctx, func(ctx context.Context) (ServerCodec, error) {
+		header := header.Clone()
+		if auth != nil {
+			if err := auth(header); err != nil {
+				return nil, err
+			}
+		}
+		conn, resp, err := dialer.DialContext(ctx, endpoint, header)
+		if err != nil {
+			hErr := wsHandshakeError{err: err}
+			if resp != nil {
+				hErr.status = resp.Status
+			}
+			return nil, hErr
+		}
+		return newWebsocketCodec(conn, nil), nil
+	})
+}
+
+// DialWebsocket 创建一个新的 RPC 客户端，它与监听在给定端点上的 JSON-RPC 服务器通信。
+//
+// 上下文用于建立初始连接。它不影响与客户端的后续交互。
+func DialWebsocket(ctx context.Context, endpoint, origin string) (*Client, error) {
+	dialer := websocket.Dialer{
+		ReadBufferSize: wsReadBuffer,
+	}
+	return DialWebsocketWithDialer(ctx, endpoint, origin, dialer)
+}
+
+func wsClientHeaders(endpoint, origin string) (string, http.Header, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint, nil, err
+	}
+	header := make(http.Header)
+	if origin != "" {
+		header.Add("origin", origin)
+	}
+	if endpointURL.User != nil {
+		b64auth := base64.StdEncoding.EncodeToString([]byte(endpointURL.User.String()))
+		header.Add("authorization", "Basic "+b64auth)
+		endpointURL.User = nil
+	}
+	return endpointURL.String(), header, nil
+}
+
+type websocketCodec struct {
+	*jsonCodec
+	conn *websocket.Conn
+	info PeerInfo
+
+	wg        sync.WaitGroup
+	pingReset chan struct{}
+}
+
+// newWebsocketCodec 创建 WebSocket 连接的编解码器。对于服务器端的连接，
+// req 是握手请求；客户端的连接传入 nil。
+func newWebsocketCodec(conn *websocket.Conn, req *http.Request) ServerCodec {
+	conn.SetReadLimit(wsMessageSizeLimit)
+	conn.SetPongHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Time{})
+		return nil
+	})
+	encode := func(v interface{}, isErrorResponse bool) error {
+		return conn.WriteJSON(v)
+	}
+	decode := func(v interface{}) error {
+		err := conn.ReadJSON(v)
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			// 对端正常关闭了连接，像其他传输方式的连接结束一样处理。
+			return io.EOF
+		}
+		return err
+	}
+	wc := &websocketCodec{
+		jsonCodec: NewFuncCodec(conn, encode, decode).(*jsonCodec),
+		conn:      conn,
+		pingReset: make(chan struct{}, 1),
+		info:      PeerInfo{Transport: "ws"},
+	}
+	if req != nil {
+		wc.info = newHTTPPeerInfo(req, "ws")
+	}
+	wc.info.RemoteAddr = conn.RemoteAddr().String()
+	// 启动 pinger。
+	wc.wg.Add(1)
+	go wc.pingLoop()
+	return wc
+}
+
+// close 向对端发送关闭消息，然后关闭连接。
+func (wc *websocketCodec) close() {
+	wc.jsonCodec.encMu.Lock()
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	wc.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsCloseTimeout))
+	wc.jsonCodec.encMu.Unlock()
+
+	wc.jsonCodec.close()
+	wc.wg.Wait()
+}
+
+func (wc *websocketCodec) peerInfo() PeerInfo {
+	return wc.info
+}
+
+func (wc *websocketCodec) writeJSON(ctx context.Context, v interface{}, isError bool) error {
+	err := wc.jsonCodec.writeJSON(ctx, v, isError)
+	if err == nil {
+		// 通知 pingLoop 推迟下一次空闲 ping。
+		select {
+		case wc.pingReset <- struct{}{}:
+		default:
+		}
+	}
+	return err
+}
+
+// pingLoop 在连接空闲时定期发送 ping 帧。如果对端在 wsPongTimeout 内
+// 没有回复 pong，读取会超时，连接随之关闭。
+func (wc *websocketCodec) pingLoop() {
+	var timer = time.NewTimer(wsPingInterval)
+	defer wc.wg.Done()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-wc.closed():
+			return
+		case <-wc.pingReset:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(wsPingInterval)
+		case <-timer.C:
+			wc.jsonCodec.encMu.Lock()
+			wc.conn.SetWriteDeadline(time.Now().Add(wsPingWriteTimeout))
+			wc.conn.WriteMessage(websocket.PingMessage, nil)
+			wc.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			wc.jsonCodec.encMu.Unlock()
+			timer.Reset(wsPingInterval)
+		}
+	}
+}